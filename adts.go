@@ -0,0 +1,141 @@
+package radicron
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// adtsHeaderBytes is the length of the ADTS header without CRC
+	adtsHeaderBytes = 7
+	// id3HeaderBytes is the length of the ID3v2 header (and the footer)
+	id3HeaderBytes = 10
+	// id3FooterFlag is set if the ID3v2 tag has the footer
+	id3FooterFlag = 0x10
+)
+
+// ConcatADTS concatenates the ADTS chunks in the order of the files into the output
+// after stripping the ID3 tags and validating the frames
+func ConcatADTS(ctx context.Context, files []string, output string) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	for _, f := range files {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if err = copyADTSFile(w, f); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+	}
+	return err
+}
+
+// copyADTSFile copies the ADTS frames in the file to w
+func copyADTSFile(w io.Writer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return copyADTSFrom(w, name, bufio.NewReader(f))
+}
+
+// copyADTSFrom copies the ADTS frames from the named source to w,
+// which must have at least one frame
+func copyADTSFrom(w io.Writer, name string, r *bufio.Reader) error {
+	n, err := copyADTS(w, r)
+	if err != nil {
+		return fmt.Errorf("invalid ADTS in %s: %s", name, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("no ADTS frame in %s", name)
+	}
+	return nil
+}
+
+// copyADTS copies the ADTS frames from r to w, skipping the ID3 tags,
+// and returns the number of frames
+func copyADTS(w io.Writer, r *bufio.Reader) (int, error) {
+	frames := 0
+	var offset int64
+	for {
+		header, err := r.Peek(id3HeaderBytes)
+		if len(header) == 0 && errors.Is(err, io.EOF) {
+			return frames, nil
+		}
+
+		// skip the ID3 tag, e.g., the timestamp in the HLS chunk
+		if len(header) >= 3 && string(header[:3]) == "ID3" {
+			if len(header) < id3HeaderBytes {
+				return frames, fmt.Errorf("truncated ID3 tag at %d", offset)
+			}
+			size := id3TagSize(header)
+			if _, err = r.Discard(size); err != nil {
+				return frames, fmt.Errorf("truncated ID3 tag at %d", offset)
+			}
+			offset += int64(size)
+			continue
+		}
+
+		if len(header) < adtsHeaderBytes {
+			return frames, fmt.Errorf("truncated ADTS header at %d", offset)
+		}
+		size, err := adtsFrameSize(header)
+		if err != nil {
+			return frames, fmt.Errorf("%s at %d", err, offset)
+		}
+		if _, err = io.CopyN(w, r, int64(size)); errors.Is(err, io.EOF) {
+			return frames, fmt.Errorf("truncated ADTS frame at %d", offset)
+		} else if err != nil {
+			return frames, err
+		}
+		offset += int64(size)
+		frames++
+	}
+}
+
+// adtsFrameSize returns the length of the ADTS frame including the header
+func adtsFrameSize(header []byte) (int, error) {
+	// the 12-bit syncword and the 2-bit layer (always 0)
+	if header[0] != 0xFF || header[1]&0xF6 != 0xF0 {
+		return 0, errors.New("no ADTS frame sync")
+	}
+	size := int(header[3]&0x03)<<11 | int(header[4])<<3 | int(header[5])>>5
+	headerSize := adtsHeaderBytes
+	if header[1]&0x01 == 0 {
+		// with CRC
+		headerSize += 2
+	}
+	if size < headerSize {
+		return 0, fmt.Errorf("invalid ADTS frame length %d", size)
+	}
+	return size, nil
+}
+
+// id3TagSize returns the length of the ID3v2 tag including the header
+func id3TagSize(header []byte) int {
+	// the syncsafe integer
+	size := int(header[6]&0x7F)<<21 | int(header[7]&0x7F)<<14 | int(header[8]&0x7F)<<7 | int(header[9]&0x7F)
+	size += id3HeaderBytes
+	if header[5]&id3FooterFlag != 0 {
+		size += id3HeaderBytes
+	}
+	return size
+}
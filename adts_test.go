@@ -0,0 +1,99 @@
+package radicron
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// adtsFrame returns an ADTS frame without CRC with the payload
+func adtsFrame(payload string) []byte {
+	size := adtsHeaderBytes + len(payload)
+	header := []byte{
+		0xFF, 0xF1, 0x50, 0x80 | byte(size>>11&0x03), byte(size >> 3), byte(size&0x07)<<5 | 0x1F, 0xFC,
+	}
+	return append(header, payload...)
+}
+
+// id3Tag returns an ID3v2 tag with the body
+func id3Tag(body string) []byte {
+	n := len(body)
+	header := []byte{'I', 'D', '3', 4, 0, 0, byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+	return append(header, body...)
+}
+
+func join(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
+
+var concatadtstests = []struct {
+	name   string
+	chunks [][]byte
+	want   []byte
+	ok     bool
+}{
+	{
+		"frames in order",
+		[][]byte{join(adtsFrame("a1"), adtsFrame("a2")), adtsFrame("b1")},
+		join(adtsFrame("a1"), adtsFrame("a2"), adtsFrame("b1")),
+		true,
+	},
+	{
+		"strip id3",
+		[][]byte{join(id3Tag("PRIV timestamp"), adtsFrame("a1")), join(id3Tag(""), adtsFrame("b1"), id3Tag("x"))},
+		join(adtsFrame("a1"), adtsFrame("b1")),
+		true,
+	},
+	{
+		"html error page",
+		[][]byte{adtsFrame("a1"), []byte("<html>403 Forbidden</html>")},
+		nil,
+		false,
+	},
+	{
+		"truncated frame",
+		[][]byte{adtsFrame("a1")[:8]},
+		nil,
+		false,
+	},
+	{
+		"id3 only",
+		[][]byte{id3Tag("PRIV timestamp")},
+		nil,
+		false,
+	},
+}
+
+func TestConcatADTS(t *testing.T) {
+	for _, tt := range concatadtstests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := []string{}
+			for i, chunk := range tt.chunks {
+				// the names in the reverse order of the playlist
+				f := filepath.Join(dir, string(rune('z'-i))+".aac")
+				if err := os.WriteFile(f, chunk, 0o600); err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, f)
+			}
+			output := filepath.Join(dir, "concated.aac")
+			err := ConcatADTS(context.Background(), files, output)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ConcatADTS => %v, want ok %v", err, tt.ok)
+			}
+			got, readErr := os.ReadFile(output)
+			if !tt.ok {
+				if readErr == nil {
+					t.Error("the output should be removed on error")
+				}
+				return
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ConcatADTS => %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/yyoshiki41/go-radiko"
@@ -42,17 +43,29 @@ type Area struct {
 type Asset struct {
 	AvailableStations []string
 	AreaDevices       Devices
-	Base64Key         string
-	Coordinates       Coordinates
-	DefaultClient     *radiko.Client
+	// areaDevicesMu guards AreaDevices for the concurrent downloads
+	areaDevicesMu sync.Mutex
+	Base64Key     string
+	Coordinates   Coordinates
+	DefaultClient *radiko.Client
+	DownloadMode  string
+	Encoding      Encoding
+	Feed          FeedConfig
+	History       *History
+	// MetadataTemplates override the DefaultMetadataTemplates
+	MetadataTemplates map[string]string
 	// MinimumOutputSize in bytes for the downloaded audio
 	MinimumOutputSize int64
 	NextFetchTime     *time.Time
 	OutputFormat      string
+	OutputTemplate    string
+	Queue             *Queue
 	Regions           Regions
 	Rules             Rules
-	Schedules         Schedules
+	Sanitizer         Sanitizer
 	Stations          Stations
+	StreamWindow      int
+	Throttle          *Throttle
 	Versions          Versions
 }
 
@@ -128,8 +141,27 @@ func (a *Asset) LoadAvailableStations(areaID string) {
 	a.AvailableStations = a.GetStationIDsByAreaID(areaID)
 }
 
+// GetDevice returns the authorized Device for the areaID,
+// creating a new one only if none exists yet
+func (a *Asset) GetDevice(ctx context.Context, areaID string) (*Device, error) {
+	a.areaDevicesMu.Lock()
+	defer a.areaDevicesMu.Unlock()
+	if device, ok := a.AreaDevices[areaID]; ok {
+		return device, nil
+	}
+	return a.newDevice(ctx, areaID)
+}
+
 // NewDevice returns a pointer to a new authorized Device
-func (a *Asset) NewDevice(areaID string) (*Device, error) {
+func (a *Asset) NewDevice(ctx context.Context, areaID string) (*Device, error) {
+	a.areaDevicesMu.Lock()
+	defer a.areaDevicesMu.Unlock()
+	return a.newDevice(ctx, areaID)
+}
+
+// newDevice authorizes a new Device and saves it for the areaID;
+// the caller must hold areaDevicesMu
+func (a *Asset) newDevice(ctx context.Context, areaID string) (*Device, error) {
 	// generate userID
 	blob := make([]byte, UserIDLength)
 	if _, err := cr.Read(blob); err != nil {
@@ -190,7 +222,7 @@ func (a *Asset) NewDevice(areaID string) (*Device, error) {
 	device.Name = fmt.Sprintf("%s.%s", sdk.ID, model)
 
 	// get token
-	err := device.Auth(a, areaID)
+	err := device.Auth(ctx, a, areaID)
 	if err != nil {
 		return device, err
 	}
@@ -260,11 +292,11 @@ type Device struct {
 	UserID     string
 }
 
-func (d *Device) Auth(a *Asset, areaID string) error {
+func (d *Device) Auth(ctx context.Context, a *Asset, areaID string) error {
 	client := a.DefaultClient
 	// auth1
 	req, _ := http.NewRequest("GET", "https://radiko.jp/v2/api/auth1", http.NoBody)
-	req = req.WithContext(context.Background())
+	req = req.WithContext(ctx)
 	headers := map[string]string{
 		UserAgentHeader:        d.UserAgent,
 		RadikoAppHeader:        d.AppName,
@@ -296,7 +328,7 @@ func (d *Device) Auth(a *Asset, areaID string) error {
 	}
 	location := a.GenerateGPSForAreaID(areaID)
 	req, _ = http.NewRequest("GET", "https://radiko.jp/v2/api/auth2", http.NoBody)
-	req = req.WithContext(context.Background())
+	req = req.WithContext(ctx)
 	headers = map[string]string{
 		UserAgentHeader:        d.UserAgent,
 		RadikoAppHeader:        d.AppName,
@@ -323,17 +355,6 @@ type Devices map[string]*Device
 
 type Regions map[string][]Area
 
-type Schedules []*Prog
-
-func (ss Schedules) HasDuplicate(prog *Prog) bool {
-	for _, s := range ss {
-		if s.ID == prog.ID {
-			return true
-		}
-	}
-	return false
-}
-
 type SDK struct {
 	ID     string   `json:"sdk"`
 	Builds []string `json:"builds"`
@@ -343,6 +364,7 @@ type Station struct {
 	Areas []string
 	Name  string
 	Ruby  string
+	Logo  string // the URL of the station logo
 }
 
 type Stations map[string]*Station
@@ -362,7 +384,7 @@ func GetAsset(ctx context.Context) *Asset {
 	return asset
 }
 
-func NewAsset(client *radiko.Client) (*Asset, error) {
+func NewAsset(ctx context.Context, client *radiko.Client) (*Asset, error) {
 	asset := &Asset{}
 	// empty AreaDevices
 	asset.AreaDevices = map[string]*Device{}
@@ -376,10 +398,20 @@ func NewAsset(client *radiko.Client) (*Asset, error) {
 	asset.DefaultClient = client
 	// empty FileFormat
 	asset.OutputFormat = radigo.AudioFormatAAC
+	// the default OutputTemplate
+	asset.OutputTemplate = DefaultOutputTemplate
+	// the default Sanitizer
+	asset.Sanitizer = Sanitizer{Mode: DefaultSanitizeMode, MaxBytes: DefaultMaxFilenameBytes}
+	// the default download-mode
+	asset.DownloadMode = DownloadModeChunks
+	asset.StreamWindow = DefaultStreamWindow
+	// the default Queue
+	asset.Queue, err = NewQueue(DefaultMaxParallelPrograms)
+	if err != nil {
+		return asset, err
+	}
 	// nil *time.Time
 	asset.NextFetchTime = nil
-	// empty Schedules
-	asset.Schedules = Schedules{}
 
 	// Region
 	regionsJSON, err := RegionsJSON.Open("assets/regions.json")
@@ -409,7 +441,7 @@ func NewAsset(client *radiko.Client) (*Asset, error) {
 	}
 
 	// Station
-	xmlRegion, err := FetchXMLRegion()
+	xmlRegion, err := FetchXMLRegion(ctx)
 	if err != nil {
 		return asset, err
 	}
@@ -423,6 +455,7 @@ func NewAsset(client *radiko.Client) (*Asset, error) {
 					Areas: []string{xmlStation.AreaID},
 					Name:  xmlStation.Name,
 					Ruby:  xmlStation.Ruby,
+					Logo:  xmlStation.Logo(),
 				}
 				asset.Stations[xmlStation.ID] = station
 			}
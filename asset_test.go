@@ -1,10 +1,12 @@
 package radicron
 
 import (
+	"context"
 	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -21,7 +23,7 @@ func TestNewAsset(t *testing.T) {
 		t.Error(err)
 	}
 
-	asset, err := NewAsset(client)
+	asset, err := NewAsset(context.Background(), client)
 	if err != nil {
 		t.Errorf("failed to parse the asset %s", err)
 	}
@@ -68,7 +70,7 @@ func TestGenerateGPSForAreaID(t *testing.T) {
 		t.Error(err)
 	}
 
-	asset, _ := NewAsset(client)
+	asset, _ := NewAsset(context.Background(), client)
 	var gpstests = []struct {
 		in  string
 		out bool
@@ -107,7 +109,7 @@ func TestGetAreaIDByStationID(t *testing.T) {
 		t.Error(err)
 	}
 
-	asset, _ := NewAsset(client)
+	asset, _ := NewAsset(context.Background(), client)
 	var areatests = []struct {
 		in  string
 		out string
@@ -139,7 +141,7 @@ func TestGetStationIDsByAreaID(t *testing.T) {
 		t.Error(err)
 	}
 
-	asset, _ := NewAsset(client)
+	asset, _ := NewAsset(context.Background(), client)
 	var stationtests = []struct {
 		in  string
 		out []string
@@ -180,7 +182,7 @@ func TestGetPartialKey(t *testing.T) {
 		t.Error(err)
 	}
 
-	asset, _ := NewAsset(client)
+	asset, _ := NewAsset(context.Background(), client)
 	partialKey, err := asset.GetPartialKey(128, 16)
 	if err != nil {
 		t.Error(err)
@@ -191,14 +193,33 @@ func TestGetPartialKey(t *testing.T) {
 	}
 }
 
+func TestGetDevice(t *testing.T) {
+	want := &Device{Name: "cached"}
+	a := &Asset{AreaDevices: Devices{"JP13": want}}
+
+	// the concurrent downloads share the device of the area
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			device, err := a.GetDevice(context.Background(), "JP13")
+			if err != nil || device != want {
+				t.Errorf("GetDevice => %v, %v, want %v", device, err, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestNewDevice(t *testing.T) {
 	client, err := radiko.New("")
 	if err != nil {
 		t.Error(err)
 	}
 
-	a, _ := NewAsset(client)
-	device, err := a.NewDevice("JP13")
+	a, _ := NewAsset(context.Background(), client)
+	device, err := a.NewDevice(context.Background(), "JP13")
 
 	if err != nil {
 		t.Error(err)
@@ -232,17 +253,3 @@ func TestNewDevice(t *testing.T) {
 		t.Errorf("invalid AuthToken: %v", got)
 	}
 }
-
-func TestSchedules(t *testing.T) {
-	ss := Schedules{
-		&Prog{
-			ID: "12345",
-		},
-	}
-	p := &Prog{
-		ID: "12345",
-	}
-	if !ss.HasDuplicate(p) {
-		t.Errorf("hasDuplicate: %v", p)
-	}
-}
@@ -0,0 +1,99 @@
+package radicron
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ChunkRecord is a line in the chunk manifest
+type ChunkRecord struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"` // sha256
+}
+
+// ChunkManifest records the chunks completely downloaded in the aac dir,
+// so that the download can be resumed after a restart
+type ChunkManifest struct {
+	mu     sync.Mutex
+	dir    string
+	chunks map[string]ChunkRecord
+}
+
+// LoadChunkManifest loads the manifest in the aac dir
+func LoadChunkManifest(dir string) (*ChunkManifest, error) {
+	m := &ChunkManifest{
+		dir:    dir,
+		chunks: map[string]ChunkRecord{},
+	}
+	file, err := os.Open(filepath.Join(dir, ChunkManifestFileName))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rec := ChunkRecord{}
+		// skip the line truncated by a crash
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Name == "" {
+			continue
+		}
+		m.chunks[rec.Name] = rec
+	}
+	return m, scanner.Err()
+}
+
+// IsComplete returns true if the chunk on disk matches the manifest;
+// the partial or corrupted chunks should be downloaded again
+func (m *ChunkManifest) IsComplete(name string) bool {
+	m.mu.Lock()
+	rec, ok := m.chunks[name]
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	size, checksum, err := fileChecksum(filepath.Join(m.dir, name))
+	if err != nil {
+		return false
+	}
+	return size == rec.Size && checksum == rec.Checksum
+}
+
+// Add records the chunk downloaded in the aac dir
+func (m *ChunkManifest) Add(name string) error {
+	size, checksum, err := fileChecksum(filepath.Join(m.dir, name))
+	if err != nil {
+		return err
+	}
+	rec := ChunkRecord{Name: name, Size: size, Checksum: checksum}
+	blob, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, err := os.OpenFile(
+		filepath.Join(m.dir, ChunkManifestFileName),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0o644, //nolint:gomnd
+	)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(blob, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	m.chunks[name] = rec
+	return nil
+}
@@ -0,0 +1,49 @@
+package radicron
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkManifest(t *testing.T) {
+	dir := t.TempDir()
+	chunk := filepath.Join(dir, "chunk1.aac")
+	if err := os.WriteFile(chunk, []byte("chunk1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadChunkManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.IsComplete("chunk1.aac") {
+		t.Error("the chunk not in the manifest should not be complete")
+	}
+	if err = m.Add("chunk1.aac"); err != nil {
+		t.Fatal(err)
+	}
+
+	// reload the manifest after a restart
+	m, err = LoadChunkManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsComplete("chunk1.aac") {
+		t.Error("the chunk in the manifest should be complete")
+	}
+
+	// the corrupted chunk should be downloaded again
+	if err = os.WriteFile(chunk, []byte("chunk"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if m.IsComplete("chunk1.aac") {
+		t.Error("the corrupted chunk should not be complete")
+	}
+	if err = os.Remove(chunk); err != nil {
+		t.Fatal(err)
+	}
+	if m.IsComplete("chunk1.aac") {
+		t.Error("the missing chunk should not be complete")
+	}
+}
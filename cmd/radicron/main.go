@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
@@ -64,12 +65,29 @@ func reload(ctx context.Context, filename string) (radicron.Rules, error) {
 	viper.SetDefault("file-format", radigo.AudioFormatAAC)
 	// set the default minimum-output-size as 1MB
 	viper.SetDefault("minimum-output-size", radicron.DefaultMinimumOutputSize)
+	// set the default output-template as <YYYYMMDDhhmm>_<station>_<title>
+	viper.SetDefault("output-template", radicron.DefaultOutputTemplate)
+	// set the default sanitize-mode as posix
+	viper.SetDefault("sanitize-mode", radicron.DefaultSanitizeMode)
+	// set the default max-filename-bytes as 255
+	viper.SetDefault("max-filename-bytes", radicron.DefaultMaxFilenameBytes)
+	// set the default max-concurrency as 64
+	viper.SetDefault("max-concurrency", radicron.MaxConcurrency)
+	// set the default max-parallel-programs as 4
+	viper.SetDefault("max-parallel-programs", radicron.DefaultMaxParallelPrograms)
+	// set the default bandwidth-limit as unlimited
+	viper.SetDefault("bandwidth-limit", 0)
+	// set the default download-mode as chunks
+	viper.SetDefault("download-mode", radicron.DownloadModeChunks)
+	// set the default stream-window as 16
+	viper.SetDefault("stream-window", radicron.DefaultStreamWindow)
+	// set the default shutdown-timeout as 10m
+	viper.SetDefault("shutdown-timeout", radicron.DefaultShutdownTimeout)
 
 	fileFormat := viper.GetString("file-format")
 
 	// check the output file format
-	if fileFormat != radigo.AudioFormatAAC &&
-		fileFormat != radigo.AudioFormatMP3 {
+	if !radicron.IsValidAudioFormat(fileFormat) {
 		return rules, fmt.Errorf("unsupported audio format: %s", fileFormat)
 	}
 	// load the available station for AreaID
@@ -81,13 +99,76 @@ func reload(ctx context.Context, filename string) (radicron.Rules, error) {
 
 	minimumOutputSize := viper.GetInt64("minimum-output-size")
 
+	// check the output template
+	outputTemplate := viper.GetString("output-template")
+	if _, err = radicron.ParseOutputTemplate(outputTemplate); err != nil {
+		return rules, fmt.Errorf("invalid output-template '%s': %s", outputTemplate, err)
+	}
+
+	// check the metadata templates for the tags
+	metadataTemplates := viper.GetStringMapString("metadata")
+	if _, err = radicron.ParseMetadataTemplates(metadataTemplates); err != nil {
+		return rules, err
+	}
+
+	// check the sanitizer for the output path
+	sanitizer, err := radicron.NewSanitizer(
+		viper.GetString("sanitize-mode"),
+		viper.GetInt("max-filename-bytes"),
+	)
+	if err != nil {
+		return rules, err
+	}
+
+	// check the encoding for the output
+	encoding := radicron.Encoding{}
+	if err = viper.UnmarshalKey("encoding", &encoding); err != nil {
+		return rules, fmt.Errorf("error reading the encoding: %s", err)
+	}
+	if err = encoding.Validate(); err != nil {
+		return rules, fmt.Errorf("invalid encoding: %s", err)
+	}
+
+	// check the podcast feeds
+	feed := radicron.FeedConfig{}
+	if err = viper.UnmarshalKey("feed", &feed); err != nil {
+		return rules, fmt.Errorf("error reading the feed: %s", err)
+	}
+	if err = feed.Validate(); err != nil {
+		return rules, fmt.Errorf("invalid feed: %s", err)
+	}
+
+	// check the shutdown-timeout
+	if _, err = time.ParseDuration(viper.GetString("shutdown-timeout")); err != nil {
+		return rules, fmt.Errorf("invalid shutdown-timeout: %s", err)
+	}
+
+	// load the download history
+	history, err := radicron.OpenHistory()
+	if err != nil {
+		return rules, fmt.Errorf("error loading the history: %s", err)
+	}
+	// free the disk from the chunks never to be resumed
+	if err = radicron.CleanTempAACDirs(history, radicron.CurrentTime); err != nil {
+		log.Printf("failed to clean the tmp: %s", err)
+	}
+
 	// save the asset in the current context
 	asset := radicron.GetAsset(ctx)
 	asset.OutputFormat = fileFormat
+	asset.OutputTemplate = outputTemplate
+	asset.MetadataTemplates = metadataTemplates
+	asset.Sanitizer = sanitizer
+	asset.Encoding = encoding
+	asset.Feed = feed
+	asset.History = history
 	asset.MinimumOutputSize = minimumOutputSize * radicron.Kilobytes * radicron.Kilobytes
 	asset.LoadAvailableStations(areaID)
 	asset.AddExtraStations(extraStations)
 	asset.RemoveIgnoreStations(ignoreStations)
+	if err = loadDownloadConfig(asset); err != nil {
+		return rules, err
+	}
 
 	// load rules from the file
 	for name := range viper.GetStringMap("rules") {
@@ -97,6 +178,9 @@ func reload(ctx context.Context, filename string) (radicron.Rules, error) {
 			return rules, fmt.Errorf("error reading the rule: %s", err)
 		}
 		rule.SetName(name)
+		if err = rule.Compile(); err != nil {
+			return rules, fmt.Errorf("error compiling the rule: %s", err)
+		}
 		// add the station-id to look up if not exists
 		if rule.HasStationID() {
 			isNewStation := true
@@ -112,39 +196,113 @@ func reload(ctx context.Context, filename string) (radicron.Rules, error) {
 		}
 		rules = append(rules, rule)
 	}
+	// sort the rules by name to resolve the ties in priority deterministically
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Name < rules[j].Name
+	})
 	return rules, nil
 }
 
-// run forever
-func run(wg *sync.WaitGroup, configFileName string) {
+// loadDownloadConfig sets the download-mode, the throttle, and the queue to the asset
+func loadDownloadConfig(asset *radicron.Asset) error {
+	// check the download-mode
+	downloadMode := viper.GetString("download-mode")
+	if !radicron.IsValidDownloadMode(downloadMode) {
+		return fmt.Errorf("unsupported download-mode: %s", downloadMode)
+	}
+	streamWindow := viper.GetInt("stream-window")
+	if streamWindow < 1 {
+		return fmt.Errorf("stream-window must be at least 1")
+	}
+
+	// configure the throttle for the chunk downloads
+	profiles := radicron.BandwidthProfiles{}
+	if err := viper.UnmarshalKey("bandwidth-profiles", &profiles); err != nil {
+		return fmt.Errorf("error reading the bandwidth-profiles: %s", err)
+	}
+	throttle, err := radicron.NewThrottle(
+		viper.GetInt("max-concurrency"),
+		viper.GetInt64("bandwidth-limit"),
+		profiles,
+	)
+	if err != nil {
+		return err
+	}
+
+	// configure the queue for the programs
+	queue, err := radicron.NewQueue(viper.GetInt("max-parallel-programs"))
+	if err != nil {
+		return err
+	}
+
+	asset.DownloadMode = downloadMode
+	asset.StreamWindow = streamWindow
+	asset.Throttle = throttle
+	asset.Queue = queue
+	return nil
+}
+
+// match is a program matched with a rule
+type match struct {
+	prog   *radicron.Prog
+	rule   *radicron.Rule
+	expiry time.Time
+}
+
+// newMatch returns the match with the expiry of the program
+func newMatch(prog *radicron.Prog, rule *radicron.Rule) match {
+	// the invalid start time is reported by Download
+	expiry, _ := prog.ExpiryTime()
+	return match{prog: prog, rule: rule, expiry: expiry}
+}
+
+// run until the ctx is done;
+// the downloads are scheduled with the downloadCtx to finish them after the ctx is done
+func run(ctx, downloadCtx context.Context, wg *sync.WaitGroup, configFileName string) {
 	client, err := radiko.New("")
 	if err != nil {
 		log.Fatal(err)
 	}
 	ck := radicron.ContextKey("asset")
+	// stop starting the queued downloads once the ctx is done
+	var queue *radicron.Queue
+	defer func() {
+		if queue != nil {
+			queue.Close()
+		}
+	}()
 	for {
 		// replenish asset
-		asset, err := radicron.NewAsset(client)
-		if err != nil {
+		asset, err := radicron.NewAsset(ctx, client)
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
 			log.Fatal(err)
 		}
 		// new context with the asset
-		ctx := context.WithValue(context.Background(), ck, asset)
+		assetCtx := context.WithValue(downloadCtx, ck, asset)
 		// reload config params
-		rules, err := reload(ctx, configFileName)
+		rules, err := reload(assetCtx, configFileName)
 		if err != nil {
 			log.Fatal(err)
 		}
+		queue = asset.Queue
 
 		// check the weekly program for each station
+		matches := []match{}
 		for _, stationID := range asset.AvailableStations {
 			if !rules.HasRuleWithoutStationID() && // search all stations
 				!rules.HasRuleForStationID(stationID) { // search this station
 				continue
 			}
 
+			// stop scheduling the new downloads
+			if ctx.Err() != nil {
+				return
+			}
+
 			// fetch the weekly program
-			weeklyPrograms, err := radicron.FetchWeeklyPrograms(stationID)
+			weeklyPrograms, err := radicron.FetchWeeklyPrograms(ctx, stationID)
 			if err != nil {
 				log.Printf("failed to fetch the %s program: %v", stationID, err)
 				continue
@@ -153,18 +311,39 @@ func run(wg *sync.WaitGroup, configFileName string) {
 
 			// check each program
 			for _, p := range weeklyPrograms {
-				if rules.HasMatch(stationID, p) {
-					err = radicron.Download(ctx, wg, p)
-					if err != nil {
-						log.Printf("downlod faild: %s", err)
-					}
+				rs := rules.Matches(stationID, p)
+				if len(rs) == 0 {
+					continue
 				}
+				// the first match wins
+				if len(rs) > 1 {
+					log.Printf("%d rules matched [%s]%s, using rule[%s]", len(rs), stationID, p.Title, rs[0].Name)
+				}
+				matches = append(matches, newMatch(p, rs[0]))
 			} // weeklyPrograms for stationID
 		} // stations
 
+		// schedule the downloads soonest-expiring first
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].expiry.Before(matches[j].expiry)
+		})
+		for _, m := range matches {
+			if ctx.Err() != nil {
+				return
+			}
+			err = radicron.Download(assetCtx, wg, m.prog, m.rule)
+			if err != nil {
+				log.Printf("downlod faild: %s", err)
+			}
+		}
+
 		// wait for all the downloading jobs
-		log.Println("waiting for all the downloads to complete")
-		wg.Wait()
+		log.Printf("waiting for all the downloads to complete (%s)", asset.Queue.Stats())
+		select {
+		case <-waitDone(wg):
+		case <-ctx.Done():
+			return
+		}
 
 		// if the next program is not found, check again 24 hours later
 		if asset.NextFetchTime == nil {
@@ -175,10 +354,41 @@ func run(wg *sync.WaitGroup, configFileName string) {
 		log.Printf("fetching completed – sleeping until %v", asset.NextFetchTime)
 		// sleep until the next earliest program to be available
 		fetchTimer := time.NewTimer(time.Until(*asset.NextFetchTime))
-		<-fetchTimer.C
+		select {
+		case <-fetchTimer.C:
+		case <-ctx.Done():
+			fetchTimer.Stop()
+			return
+		}
 	}
 }
 
+// shutdown waits for the downloads in progress until the timeout and aborts the rest
+func shutdown(wg *sync.WaitGroup, abort context.CancelFunc, timeout time.Duration) {
+	log.Printf("exit once all the downloads complete (or abort in %v)", timeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-waitDone(wg):
+		return
+	case <-timer.C:
+	}
+	// the aborted downloads are resumed in the next run
+	log.Println("aborting the downloads in progress")
+	abort()
+	wg.Wait()
+}
+
+// waitDone returns a channel closed when the wg is done
+func waitDone(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
 func main() {
 	// Set the config location
 	conf := flag.String("c", "config.yml", "the config.yml to use.")
@@ -198,16 +408,19 @@ func main() {
 		log.SetFlags(log.LstdFlags | log.Lshortfile)
 	}
 
+	// listen for SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	downloadCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+
 	log.Println("starting radicron")
 	wg := sync.WaitGroup{}
-	run(&wg, *conf)
+	run(ctx, downloadCtx, &wg, *conf)
 
-	// listen for SIGINT/SIGTERM
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// the second signal terminates immediately
+	stop()
 	// finish the downloading in progress
-	log.Println("exit once all the downloads complete")
-	wg.Wait()
+	shutdown(&wg, abort, viper.GetDuration("shutdown-timeout"))
 	log.Println("exiting radicron")
 }
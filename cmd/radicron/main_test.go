@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"sync"
 	"testing"
 	"time"
 
@@ -22,7 +23,7 @@ func TestConfig(t *testing.T) {
 		log.Fatal(err)
 	}
 	ck := radicron.ContextKey("asset")
-	asset, err := radicron.NewAsset(client)
+	asset, err := radicron.NewAsset(context.Background(), client)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -46,3 +47,30 @@ func TestConfig(t *testing.T) {
 		t.Errorf("asset.AvailableStations: %v => want %v", got, nStations)
 	}
 }
+
+func TestShutdown(t *testing.T) {
+	// drain the downloads completed in time
+	wg := sync.WaitGroup{}
+	ctx, abort := context.WithCancel(context.Background())
+	defer abort()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(10 * time.Millisecond)
+	}()
+	shutdown(&wg, abort, time.Minute)
+	if ctx.Err() != nil {
+		t.Error("the downloads completed in time should not be aborted")
+	}
+
+	// abort the downloads after the timeout
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+	}()
+	shutdown(&wg, abort, 10*time.Millisecond)
+	if ctx.Err() == nil {
+		t.Error("the downloads in progress should be aborted")
+	}
+}
@@ -1,32 +1,62 @@
 package radicron
 
 const (
+	// BroadcastDayStartHour is when the radiko broadcast day starts (i.e., 00:00-04:59 is 24:00-28:59)
+	BroadcastDayStartHour = 5
 	// BufferMinutes for fetching the playlist.m3u8 chunks
 	BufferMinutes = 5
+	// ChunkManifestFileName for the chunks downloaded in the aac dir
+	ChunkManifestFileName = "manifest.jsonl"
+	// ChunkTimeoutSeconds for fetching a chunk, after which the chunk is retried
+	ChunkTimeoutSeconds = 30
 	// DatetimeLayout for time strings from radiko
 	DatetimeLayout = "20060102150405"
 	// DefaultArea for radiko are
 	DefaultArea = "JP13"
-	// RetryDelaySecond for initial delay
-	DefaultInitialDelaySeconds = 60
+	// DefaultInitialDelaySeconds for the first retry, doubled for each retry up to MaxRetryDelaySeconds
+	DefaultInitialDelaySeconds = 1
 	// DefaultInterval to fetch the programs
 	DefaultInterval = "168h"
+	// DefaultMaxFilenameBytes for each element of the output path
+	DefaultMaxFilenameBytes = 255
+	// DefaultMaxParallelPrograms to download at once
+	DefaultMaxParallelPrograms = 4
 	// DefaultMinimumOutputSize
 	DefaultMinimumOutputSize = 1
+	// DefaultOutputTemplate for the downloaded files, i.e., <YYYYMMDDhhmm>_<station>_<title>
+	DefaultOutputTemplate = `{{.Date "200601021504"}}_{{.StationID}}_{{.Title}}`
 	// Environment Variable for RADICRON_HOME
 	EnvRadicronHome = "RADICRON_HOME"
+	// DefaultSanitizeMode for the output path
+	DefaultSanitizeMode = SanitizeModePOSIX
+	// DefaultShutdownTimeout to wait for the downloads in progress
+	DefaultShutdownTimeout = "10m"
+	// DefaultStreamWindow is the number of chunks in memory for the stream download-mode
+	DefaultStreamWindow = 16
+	// HistoryFileName for the download history ledger in RADICRON_HOME
+	HistoryFileName = "history.jsonl"
 	// Language for ID3v2 tags
 	ID3v2LangJPN = "jpn"
+	// ImageCacheDir for the program images and the station logos in RADICRON_HOME
+	ImageCacheDir = "cache/images"
 	// Kilobytes for the metric bytes
 	Kilobytes = 1024
-	// DefaultMaxConcurrents
+	// MaxConcurrency is the default max-concurrency for the chunk downloads
 	MaxConcurrency = 64
-	// MaxRetryAttempts for BackOffDelay
+	// MaxRetryAttempts for backoffDelay
 	MaxRetryAttempts = 8
+	// MaxRetryDelaySeconds caps the backoff delay between the retries
+	MaxRetryDelaySeconds = 60
+	// MinFilenameBytes for max-filename-bytes
+	MinFilenameBytes = 32
+	// NoRuleName is the rule name for the programs downloaded without a rule
+	NoRuleName = "-"
 	// OneDay is 24 hours
 	OneDay = 24
 	// OutputDatetimeLayout for downloaded files
 	OutputDatetimeLayout = "200601021504"
+	// TimeshiftRetentionDays for the programs available in the radiko timeshift
+	TimeshiftRetentionDays = 7
 	// TZTokyo for time location
 	TZTokyo = "Asia/Tokyo"
 	// UserIDLength for user-id
@@ -6,24 +6,34 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/bogem/id3v2"
 	"github.com/grafov/m3u8"
 	"github.com/yyoshiki41/radigo"
 )
 
-var sem = make(chan struct{}, MaxConcurrency)
+var (
+	// retryDelayBase is the backoff delay for the first retry
+	retryDelayBase = DefaultInitialDelaySeconds * time.Second
+	// chunkClient gives up the stalled chunk to be retried
+	chunkClient = &http.Client{Timeout: ChunkTimeoutSeconds * time.Second}
+)
 
+// Download schedules the download of the program matched with the rule
 func Download(
 	ctx context.Context,
 	wg *sync.WaitGroup,
 	prog *Prog,
+	rule *Rule,
 ) (err error) {
 	asset := GetAsset(ctx)
 	title := prog.Title
@@ -49,23 +59,32 @@ func Download(
 		return nil
 	}
 
-	// the program is already to be downloaded
-	if asset.Schedules.HasDuplicate(prog) {
+	// the program is no longer available in the timeshift
+	expiry, err := prog.ExpiryTime()
+	if err != nil {
+		return fmt.Errorf("invalid start time format '%s': %s", start, err)
+	}
+	if !expiry.After(CurrentTime) {
+		log.Printf("-skip expired [%s]%s (%s): the timeshift ended at %v", prog.StationID, title, start, expiry)
+		return nil
+	}
+
+	// the program is already downloaded or to be downloaded
+	if asset.History.IsDone(prog) {
 		log.Printf("-skip duplicate [%s]%s (%s)", prog.StationID, title, start)
 		return nil
 	}
-	asset.Schedules = append(asset.Schedules, prog)
 
 	// the output config
-	output, err := newOutputConfig(
-		fmt.Sprintf(
-			"%s_%s_%s",
-			startTime.In(Location).Format(OutputDatetimeLayout),
-			prog.StationID,
-			title,
-		),
-		asset.OutputFormat,
-	)
+	fileFormat := asset.OutputFormat
+	if rule != nil && rule.FileFormat != "" {
+		fileFormat = rule.FileFormat
+	}
+	outputPath, err := OutputPath(asset, prog, rule, fileFormat)
+	if err != nil {
+		return fmt.Errorf("failed to render the output path: %s", err)
+	}
+	output, err := newOutputConfig(outputPath, fileFormat, asset.Sanitizer)
 	if err != nil {
 		return fmt.Errorf("failed to configure output: %s", err)
 	}
@@ -73,28 +92,30 @@ func Download(
 		return fmt.Errorf("failed to setup the output dir: %s", err)
 	}
 	if output.IsExist() {
+		// adopt the file downloaded before the history
 		log.Printf("-skip already exists: %s", output.AbsPath())
-		return nil
+		return asset.History.Record(prog, rule, HistoryStatusCompleted, output.AbsPath())
 	}
 
-	// fetch the recording m3u8 uri
-	uri, err := timeshiftProgM3U8(ctx, prog)
-	if err != nil {
-		return fmt.Errorf(
-			"playlist.m3u8 not available [%s]%s (%s): %s",
-			prog.StationID,
-			title,
-			start,
-			err,
-		)
-	}
-	log.Printf("start downloading [%s]%s (%s): %s", prog.StationID, title, start, uri)
-	prog.M3U8 = uri
-	wg.Add(1)
-	go downloadProgram(ctx, wg, prog, output)
+	// queue the download
+	log.Printf("queue downloading [%s]%s (%s) for rule[%s], expiring in %v",
+		prog.StationID, title, start, rule.GetName(), expiry.Sub(CurrentTime).Round(time.Minute))
+	if err = asset.History.Record(prog, rule, HistoryStatusDownloading, output.AbsPath()); err != nil {
+		return fmt.Errorf("failed to record the history: %s", err)
+	}
+	asset.Queue.Push(ctx, wg, &Job{Prog: prog, Rule: rule, Output: output, Expiry: expiry})
 	return nil
 }
 
+// IsValidAudioFormat returns true if the output file format is supported
+func IsValidAudioFormat(fileFormat string) bool {
+	switch fileFormat {
+	case radigo.AudioFormatAAC, radigo.AudioFormatMP3, AudioFormatM4A, AudioFormatOpus, AudioFormatFLAC:
+		return true
+	}
+	return false
+}
+
 func buildM3U8RequestURI(prog *Prog) string {
 	u, err := url.Parse(APIPlaylistM3U8)
 	if err != nil {
@@ -116,135 +137,354 @@ func buildM3U8RequestURI(prog *Prog) string {
 	return u.String()
 }
 
-func bulkDownload(list []string, output string) error {
-	var errFlag bool
+// bulkDownload downloads the chunks in the list to the output dir
+// except the ones already completed in the manifest until the ctx is done
+func bulkDownload(ctx context.Context, list []string, output string, manifest *ChunkManifest) error {
+	var errFlag atomic.Bool
 	var wg sync.WaitGroup
 
+	// the throttle is shared by all the programs
+	throttle := getThrottle(ctx)
+
+	resumed := 0
 	for _, v := range list {
+		_, fileName := filepath.Split(v)
+		if manifest.IsComplete(fileName) {
+			resumed++
+			continue
+		}
 		wg.Add(1)
-		go func(link string) {
+		go func(link, fileName string) {
 			defer wg.Done()
 
-			var err error
-			for i := 0; i < MaxRetryAttempts; i++ {
-				sem <- struct{}{}
-				err = downloadLink(link, output)
-				<-sem
-				if err == nil {
-					break
-				}
+			err := retryDownload(ctx, throttle, func() error {
+				return downloadLink(ctx, link, output, throttle.Rate)
+			})
+			if err == nil {
+				err = manifest.Add(fileName)
 			}
 			if err != nil {
 				log.Printf("failed to download: %s", err)
-				errFlag = true
+				errFlag.Store(true)
 			}
-		}(v)
+		}(v, fileName)
+	}
+	if resumed > 0 {
+		log.Printf("resume downloading with %d/%d chunks in %s", resumed, len(list), output)
 	}
 	wg.Wait()
 
-	if errFlag {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errFlag.Load() {
 		return errors.New("lack of aac files")
 	}
 	return nil
 }
 
-func downloadLink(link, output string) error {
-	resp, err := http.Get(link) //nolint:gosec,noctx
-	if err != nil {
-		return err
+// getThrottle returns the throttle of the asset in the ctx or the default one
+func getThrottle(ctx context.Context) *Throttle {
+	if asset := GetAsset(ctx); asset != nil && asset.Throttle != nil {
+		return asset.Throttle
 	}
-	defer resp.Body.Close()
+	return defaultThrottle
+}
+
+// retryDownload calls the download within the throttle with the backoff
+// until it succeeds, fails with a fatalError, or the ctx is done
+func retryDownload(ctx context.Context, throttle *Throttle, download func() error) (err error) {
+	for i := 0; i < MaxRetryAttempts; i++ {
+		if i > 0 {
+			if err = sleepContext(ctx, backoffDelay(i)); err != nil {
+				return err
+			}
+		}
+		if err = throttle.Acquire(ctx); err != nil {
+			return err
+		}
+		err = download()
+		throttle.Release()
+		if err == nil {
+			return nil
+		}
+		var fatal *fatalError
+		if errors.As(err, &fatal) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
 
+// downloadLink downloads the chunk in the output dir within the rate;
+// the error is a fatalError if retrying would not help
+func downloadLink(ctx context.Context, link, output string, rate *RateLimiter) error {
 	_, fileName := filepath.Split(link)
 	file, err := os.Create(filepath.Join(output, fileName))
 	if err != nil {
-		return err
+		return &fatalError{err}
 	}
 
-	_, err = io.Copy(file, resp.Body)
+	err = fetchLink(ctx, link, file, rate)
 	if closeErr := file.Close(); err == nil {
 		err = closeErr
 	}
 	return err
 }
 
+// fetchLink writes the chunk to w within the rate;
+// the error is a fatalError if retrying would not help
+func fetchLink(ctx context.Context, link string, w io.Writer, rate *RateLimiter) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, http.NoBody)
+	if err != nil {
+		return &fatalError{err}
+	}
+	resp, err := chunkClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = checkChunkResponse(resp); err != nil {
+		return err
+	}
+
+	n, err := io.Copy(w, rate.Reader(ctx, resp.Body))
+	if err != nil {
+		return err
+	}
+	if n == 0 || (resp.ContentLength > 0 && n != resp.ContentLength) {
+		return fmt.Errorf("incomplete chunk %s: %d/%d bytes", link, n, resp.ContentLength)
+	}
+	return nil
+}
+
+// fatalError is the download error not to be retried
+type fatalError struct {
+	error
+}
+
+// checkChunkResponse returns an error if the response is not an audio chunk;
+// 5xx and 429 are retryable, and other statuses are fatal
+func checkChunkResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode >= http.StatusInternalServerError,
+		resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%s: %s", resp.Request.URL, resp.Status)
+	default:
+		return &fatalError{fmt.Errorf("%s: %s", resp.Request.URL, resp.Status)}
+	}
+
+	// e.g., an HTML error page with 200
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		// radiko may not set the content-type
+		return nil
+	}
+	if strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "/json") ||
+		strings.HasSuffix(mediaType, "/xml") {
+		return &fatalError{fmt.Errorf("%s: unexpected content-type %s", resp.Request.URL, mediaType)}
+	}
+	return nil
+}
+
+// sleepContext pauses for the duration until the ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoffDelay returns the exponential delay with the equal jitter for the attempt from 1,
+// i.e., a random delay between the half and the whole, which is capped by MaxRetryDelaySeconds
+func backoffDelay(attempt int) time.Duration {
+	delay := retryDelayBase << (attempt - 1)
+	if limit := MaxRetryDelaySeconds * time.Second; delay <= 0 || delay > limit {
+		delay = limit
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)) //nolint:gosec
+}
+
 // downloadProgram manages the download for the given program
-// in a go routine and notify the wg when finished
+// and returns the status recorded in the history
 func downloadProgram(
 	ctx context.Context, // the context for the request
-	wg *sync.WaitGroup, // the wg to notify
 	prog *Prog, // the program metadata
+	rule *Rule, // the matched rule
 	output *radigo.OutputConfig, // the file configuration
-) {
-	defer wg.Done()
+) (status string) {
 	var err error
 
-	chunklist, err := getChunklistFromM3U8(prog.M3U8)
+	// record the result in the history
+	asset := GetAsset(ctx)
+	status = HistoryStatusFailed
+	defer func() {
+		// the download is resumed in the next run
+		if status != HistoryStatusCompleted && ctx.Err() != nil {
+			status = HistoryStatusInterrupted
+		}
+		if err := asset.History.Record(prog, rule, status, output.AbsPath()); err != nil {
+			log.Printf("failed to record the history: %s", err)
+			return
+		}
+		if status == HistoryStatusCompleted {
+			if err := GenerateFeeds(asset); err != nil {
+				log.Printf("failed to generate the feeds: %s", err)
+			}
+		}
+	}()
+
+	// fetch the recording m3u8 uri
+	uri, err := timeshiftProgM3U8(ctx, prog)
 	if err != nil {
-		log.Printf("failed to get chunklist: %s", err)
-		return
+		log.Printf("playlist.m3u8 not available [%s]%s (%s): %s", prog.StationID, prog.Title, prog.Ft, err)
+		return status
 	}
+	log.Printf("start downloading [%s]%s (%s) for rule[%s]: %s", prog.StationID, prog.Title, prog.Ft, rule.GetName(), uri)
+	prog.M3U8 = uri
 
-	aacDir, err := tempAACDir()
+	chunklist, err := getChunklistFromM3U8(ctx, prog.M3U8)
 	if err != nil {
-		log.Printf("failed to create the aac dir: %s", err)
-		return
+		log.Printf("failed to get chunklist: %s", err)
+		return status
 	}
-	defer os.RemoveAll(aacDir) // clean up
 
-	if err = bulkDownload(chunklist, aacDir); err != nil {
-		log.Printf("failed to download aac files: %s", err)
-		return
+	var concatedFile string
+	if asset.DownloadMode == DownloadModeStream {
+		// write the concatenated aac without the temporary chunks
+		if concatedFile, err = tempAACFile(prog); err == nil {
+			err = streamDownload(ctx, chunklist, concatedFile, asset.StreamWindow)
+		}
+	} else {
+		concatedFile, err = downloadChunks(ctx, prog, chunklist)
 	}
-
-	concatedFile, err := radigo.ConcatAACFilesFromList(ctx, aacDir)
 	if err != nil {
-		log.Printf("failed to concat aac files: %s", err)
-		return
-	}
-
-	switch output.AudioFormat() {
-	case radigo.AudioFormatAAC:
-		err = os.Rename(concatedFile, output.AbsPath())
-	case radigo.AudioFormatMP3:
-		err = radigo.ConvertAACtoMP3(ctx, concatedFile, output.AbsPath())
-	default:
-		err = fmt.Errorf("invalid file format")
+		log.Printf("failed to download the program: %s", err)
+		return status
 	}
+	defer os.Remove(concatedFile) // clean up
 
+	tmpOutput, err := encodeOutput(ctx, asset.Encoding, prog, concatedFile, output)
 	if err != nil {
 		log.Printf("failed to write the output file: %s", err)
-		return
+		return status
 	}
+	defer os.Remove(tmpOutput) // clean up unless saved
 
-	info, err := os.Stat(output.AbsPath())
+	info, err := os.Stat(tmpOutput)
 	if err != nil {
 		log.Printf("failed to stat the output file: %s", err)
-		return
+		return status
 	}
 
-	asset := GetAsset(ctx)
-	if info.Size() < asset.MinimumOutputSize {
+	minimumOutputSize := asset.MinimumOutputSize
+	if rule != nil && rule.MinimumOutputSize > 0 {
+		minimumOutputSize = rule.MinimumOutputSize * Kilobytes * Kilobytes
+	}
+	if info.Size() < minimumOutputSize {
 		log.Printf("the output file is too small: %v MB", float32(info.Size())/Kilobytes/Kilobytes)
-		err = os.Remove(output.AbsPath())
+		err = os.Remove(tmpOutput)
 		if err != nil {
 			log.Printf("failed to remove the file: %v", err)
-			return
+			return status
 		}
 		next := time.Now().In(Location).Add(BufferMinutes * time.Minute)
 		asset.NextFetchTime = &next
 		log.Printf("removed the file, retry downloading at %v", next)
-		return
+		return status
 	}
 
-	err = writeID3Tag(output, prog)
-	if err != nil {
-		log.Printf("ID3v2: %v", err)
-		return
+	// tag the file in the native format
+	if err = tagOutput(ctx, asset, prog, rule, output, tmpOutput); err != nil {
+		log.Printf("tagger: %v", err)
+		return status
+	}
+
+	// the partial output is not taken as downloaded
+	if err = os.Rename(tmpOutput, output.AbsPath()); err != nil {
+		log.Printf("failed to save the output file: %s", err)
+		return status
 	}
 
 	// finish downloading the file
+	status = HistoryStatusCompleted
 	log.Printf("+file saved: %s", output.AbsPath())
+	return status
+}
+
+// tagOutput writes the metadata for the output to the file at the path with the tagger for the format
+func tagOutput(ctx context.Context, asset *Asset, prog *Prog, rule *Rule, output *radigo.OutputConfig, path string) error {
+	tagger, err := NewTagger(output.AudioFormat())
+	if err != nil {
+		return err
+	}
+	md, err := NewMetadata(asset, prog, rule, output)
+	if err != nil {
+		return err
+	}
+	// tag without the cover if the image is unavailable
+	if md.Cover, err = CoverImage(ctx, asset, prog); err != nil {
+		log.Printf("cover: %v", err)
+	}
+	return tagger.Tag(ctx, path, md)
+}
+
+// downloadChunks downloads the chunks in the aac dir to resume the download
+// and returns the file concatenated in the order of the playlist
+func downloadChunks(ctx context.Context, prog *Prog, chunklist []string) (string, error) {
+	aacDir, err := tempAACDir(prog)
+	if err != nil {
+		return "", fmt.Errorf("failed to create the aac dir: %s", err)
+	}
+	manifest, err := LoadChunkManifest(aacDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to load the chunk manifest: %s", err)
+	}
+
+	if err = bulkDownload(ctx, chunklist, aacDir, manifest); err != nil {
+		return "", fmt.Errorf("failed to download aac files: %s", err)
+	}
+
+	files := make([]string, 0, len(chunklist))
+	for _, link := range chunklist {
+		_, fileName := filepath.Split(link)
+		files = append(files, filepath.Join(aacDir, fileName))
+	}
+	concatedFile := aacDir + ".aac"
+	if err = ConcatADTS(ctx, files, concatedFile); err != nil {
+		if ctx.Err() == nil {
+			// download the invalid chunks again in the next try
+			os.RemoveAll(aacDir)
+		}
+		return "", fmt.Errorf("failed to concat aac files: %s", err)
+	}
+	return concatedFile, os.RemoveAll(aacDir)
+}
+
+// encodeOutput encodes the concatenated AAC into a temporary file next to the output
+// and returns the path; the short name leaves the room for the encoder and the tagger,
+// since the name of the output may already be at max-filename-bytes
+func encodeOutput(ctx context.Context, encoding Encoding, prog *Prog, input string, output *radigo.OutputConfig) (string, error) {
+	encoder, err := NewEncoder(output.AudioFormat(), encoding)
+	if err != nil {
+		return "", err
+	}
+	tmpOutput, err := tempName(output.DirFullPath, ".radicron-*."+output.AudioFormat())
+	if err != nil {
+		return "", err
+	}
+	if err = encoder.Encode(ctx, input, tmpOutput, prog); err != nil {
+		os.Remove(tmpOutput)
+		return "", err
+	}
+	return tmpOutput, nil
 }
 
 // getChunklist returns a slice of uri string.
@@ -265,8 +505,12 @@ func getChunklist(input io.Reader) ([]string, error) {
 }
 
 // getChunklistFromM3U8 returns a slice of url.
-func getChunklistFromM3U8(uri string) ([]string, error) {
-	resp, err := http.Get(uri) //nolint:gosec,noctx
+func getChunklistFromM3U8(ctx context.Context, uri string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -313,9 +557,15 @@ func getURI(input io.Reader) (string, error) {
 	return p.Variants[0].URI, nil
 }
 
-// newOutputConfig prepares the outputdir
-func newOutputConfig(fileBaseName, fileFormat string) (*radigo.OutputConfig, error) {
-	fullPath, err := getRadicronPath("downloads")
+// newOutputConfig prepares the outputdir for the path relative to the downloads
+// after sanitizing the path for the file systems
+func newOutputConfig(outputPath, fileFormat string, sanitizer Sanitizer) (*radigo.OutputConfig, error) {
+	if sanitizer.MaxBytes == 0 {
+		sanitizer.MaxBytes = DefaultMaxFilenameBytes
+	}
+	outputPath = sanitizer.Path(outputPath, fileFormat)
+	dir, fileBaseName := filepath.Split(outputPath)
+	fullPath, err := getRadicronPath(filepath.Join("downloads", dir))
 	if err != nil {
 		return nil, err
 	}
@@ -327,21 +577,82 @@ func newOutputConfig(fileBaseName, fileFormat string) (*radigo.OutputConfig, err
 	}, nil
 }
 
-// tempAACDir creates a dir to store temporary aac files
-func tempAACDir() (string, error) {
-	fullPath, err := getRadicronPath("tmp")
+// tempAACDir creates a dir to store temporary aac files for the program,
+// which is the same across the restarts
+func tempAACDir(prog *Prog) (string, error) {
+	aacDir, err := getRadicronPath(filepath.Join("tmp", "aac_"+HistoryKey(prog)))
 	if err != nil {
 		return "", err
 	}
 
-	aacDir, err := os.MkdirTemp(fullPath, "aac")
-	if err != nil {
+	if err = os.MkdirAll(aacDir, 0o755); err != nil { //nolint:gomnd
 		return "", err
 	}
 
 	return aacDir, nil
 }
 
+// tempAACFile returns the path of the concatenated aac for the program in the tmp dir,
+// which has the same name as the one from the aac dir
+func tempAACFile(prog *Prog) (string, error) {
+	tmpDir, err := getRadicronPath("tmp")
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(tmpDir, 0o755); err != nil { //nolint:gomnd
+		return "", err
+	}
+	return filepath.Join(tmpDir, "aac_"+HistoryKey(prog)+".aac"), nil
+}
+
+// CleanTempAACDirs removes the aac dirs left for resuming the downloads
+// once the program is expired from the timeshift or completed in the history
+func CleanTempAACDirs(history *History, now time.Time) error {
+	tmpDir, err := getRadicronPath("tmp")
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		prog, ok := tempAACProg(e.Name())
+		if !ok {
+			continue
+		}
+		expiry, err := prog.ExpiryTime()
+		if err != nil {
+			continue
+		}
+		if rec, ok := history.Get(prog); !now.After(expiry) && (!ok || rec.Status != HistoryStatusCompleted) {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(tmpDir, e.Name())); err != nil {
+			return err
+		}
+		log.Printf("removed the stale chunks: %s", e.Name())
+	}
+	return nil
+}
+
+// tempAACProg returns the program of the aac dir (or its concatenated aac)
+// named by tempAACDir, i.e., aac_<station>_<ft>_<id>
+func tempAACProg(name string) (*Prog, bool) {
+	key, ok := strings.CutPrefix(strings.TrimSuffix(name, ".aac"), "aac_")
+	if !ok {
+		return nil, false
+	}
+	// the station ID has no underscore but the program ID may have
+	elems := strings.SplitN(key, "_", 3) //nolint:gomnd
+	if len(elems) != 3 || len(elems[1]) != len(DatetimeLayout) {
+		return nil, false
+	}
+	return &Prog{StationID: elems[0], Ft: elems[1], ID: elems[2]}, true
+}
+
 // timeshiftProgM3U8 gets playlist.m3u8 for a Prog
 func timeshiftProgM3U8(
 	ctx context.Context,
@@ -354,12 +665,9 @@ func timeshiftProgM3U8(
 
 	areaID := asset.GetAreaIDByStationID(prog.StationID)
 
-	device, ok := asset.AreaDevices[areaID]
-	if !ok {
-		device, err = asset.NewDevice(areaID)
-		if err != nil {
-			return "", err
-		}
+	device, err := asset.GetDevice(ctx, areaID)
+	if err != nil {
+		return "", err
 	}
 
 	uri := buildM3U8RequestURI(prog)
@@ -381,29 +689,3 @@ func timeshiftProgM3U8(
 
 	return getURI(resp.Body)
 }
-
-func writeID3Tag(output *radigo.OutputConfig, prog *Prog) error {
-	tag, err := id3v2.Open(output.AbsPath(), id3v2.Options{Parse: true})
-	if err != nil {
-		return fmt.Errorf("error while opening the output file: %s", err)
-	}
-	defer tag.Close()
-
-	// Set tags
-	tag.SetTitle(output.FileBaseName)
-	tag.SetArtist(prog.Pfm)
-	tag.SetAlbum(prog.Title)
-	tag.SetYear(prog.Ft[:4])
-	tag.AddCommentFrame(id3v2.CommentFrame{
-		Encoding:    id3v2.EncodingUTF8,
-		Language:    ID3v2LangJPN,
-		Description: prog.Info,
-	})
-
-	// write tag to the aac
-	if err = tag.Save(); err != nil {
-		return fmt.Errorf("error while saving a tag: %s", err)
-	}
-
-	return nil
-}
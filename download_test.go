@@ -1,8 +1,18 @@
 package radicron
 
 import (
+	"context"
 	"embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var (
@@ -37,3 +47,328 @@ func TestGetURI(t *testing.T) {
 		t.Errorf("getURI => %v, want %v", uri, want)
 	}
 }
+
+func TestNewOutputConfig(t *testing.T) {
+	t.Setenv(EnvRadicronHome, t.TempDir())
+	sanitizer := Sanitizer{Mode: SanitizeModeWindows, MaxBytes: 64}
+	output, err := newOutputConfig(
+		"THE TRAD/202306051300_FMT_THE TRAD: Special?「オールナイトニッポン」",
+		"aac",
+		sanitizer,
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	want := "202306051300_FMT_THE TRAD： Special？「オールナイト"
+	if output.FileBaseName != want {
+		t.Errorf("output.FileBaseName => %q, want %q", output.FileBaseName, want)
+	}
+	if filepath.Base(output.DirFullPath) != "THE TRAD" {
+		t.Errorf("output.DirFullPath => %q, want THE TRAD", output.DirFullPath)
+	}
+	if len(filepath.Base(output.AbsPath())) > sanitizer.MaxBytes {
+		t.Errorf("output.AbsPath() => %q, too long", output.AbsPath())
+	}
+}
+
+func TestEncodeOutputLongName(t *testing.T) {
+	t.Setenv(EnvRadicronHome, t.TempDir())
+	// the name at max-filename-bytes
+	output, err := newOutputConfig(strings.Repeat("あ", 83)+strings.Repeat("a", 10), "aac", Sanitizer{Mode: SanitizeModePOSIX})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(filepath.Base(output.AbsPath())); n != DefaultMaxFilenameBytes {
+		t.Fatalf("the output name has %d bytes, want %d", n, DefaultMaxFilenameBytes)
+	}
+	if err = os.MkdirAll(output.DirFullPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(t.TempDir(), "in.aac")
+	if err = os.WriteFile(input, adtsFrame(strings.Repeat("a", 64)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	prog := &Prog{StationID: "FMT", Ft: "20230605130000", To: "20230605145500", Title: "title"}
+	tmpOutput, err := encodeOutput(ctx, Encoding{}, prog, input, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tagOutput(ctx, nil, prog, nil, output, tmpOutput); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(tmpOutput, output.AbsPath()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(output.AbsPath()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBulkDownload(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "audio/aac")
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	list := []string{ts.URL + "/chunk1.aac", ts.URL + "/chunk2.aac", ts.URL + "/chunk3.aac"}
+	manifest, err := LoadChunkManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bulkDownload(context.Background(), list[:2], dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	// a partial chunk left by a crash
+	if err = os.WriteFile(filepath.Join(dir, "chunk3.aac"), []byte("/chunk"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// resume with the reloaded manifest
+	manifest, err = LoadChunkManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bulkDownload(context.Background(), list, dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Errorf("bulkDownload requests => %d, want 3", n)
+	}
+	for _, name := range []string{"chunk1.aac", "chunk2.aac", "chunk3.aac"} {
+		blob, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(blob) != "/"+name {
+			t.Errorf("%s => %q, %v", name, blob, err)
+		}
+		if !manifest.IsComplete(name) {
+			t.Errorf("%s should be complete", name)
+		}
+	}
+}
+
+var downloadlinktests = []struct {
+	name        string
+	status      int
+	contentType string
+	body        string
+	fatal       bool
+	ok          bool
+}{
+	{"ok", http.StatusOK, "audio/aac", "aac", false, true},
+	{"no content-type", http.StatusOK, "", "aac", false, true},
+	{"error page", http.StatusOK, "text/html; charset=utf-8", "<html>", true, false},
+	{"empty", http.StatusOK, "audio/aac", "", false, false},
+	{"forbidden", http.StatusForbidden, "audio/aac", "aac", true, false},
+	{"not found", http.StatusNotFound, "text/html", "<html>", true, false},
+	{"too many requests", http.StatusTooManyRequests, "text/plain", "", false, false},
+	{"unavailable", http.StatusServiceUnavailable, "text/html", "<html>", false, false},
+}
+
+func TestDownloadLink(t *testing.T) {
+	for _, tt := range downloadlinktests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer ts.Close()
+
+			err := downloadLink(context.Background(), ts.URL+"/chunk.aac", t.TempDir(), nil)
+			if (err == nil) != tt.ok {
+				t.Fatalf("downloadLink => %v, want ok %v", err, tt.ok)
+			}
+			var fatal *fatalError
+			if errors.As(err, &fatal) != tt.fatal {
+				t.Errorf("downloadLink => %v, want fatal %v", err, tt.fatal)
+			}
+		})
+	}
+}
+
+func TestBulkDownloadRetry(t *testing.T) {
+	defer func(d time.Duration) { retryDelayBase = d }(retryDelayBase)
+	retryDelayBase = time.Millisecond
+
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		switch {
+		case r.URL.Path == "/missing.aac":
+			w.WriteHeader(http.StatusNotFound)
+		case n == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Header().Set("Content-Type", "audio/aac")
+			fmt.Fprint(w, "aac")
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	manifest, err := LoadChunkManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// retry the 5xx
+	if err = bulkDownload(context.Background(), []string{ts.URL + "/chunk.aac"}, dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("bulkDownload requests => %d, want 2", n)
+	}
+	// give up the 4xx
+	if err = bulkDownload(context.Background(), []string{ts.URL + "/missing.aac"}, dir, manifest); err == nil {
+		t.Error("bulkDownload should fail with 404")
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Errorf("bulkDownload requests => %d, want 3", n)
+	}
+}
+
+func TestBulkDownloadTimeout(t *testing.T) {
+	defer func(d time.Duration) { retryDelayBase = d }(retryDelayBase)
+	retryDelayBase = time.Millisecond
+	defer func(c *http.Client) { chunkClient = c }(chunkClient)
+	chunkClient = &http.Client{Timeout: 100 * time.Millisecond}
+
+	stalled := make(chan struct{})
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			<-stalled
+			return
+		}
+		w.Header().Set("Content-Type", "audio/aac")
+		fmt.Fprint(w, "aac")
+	}))
+	defer ts.Close()
+	defer close(stalled)
+
+	dir := t.TempDir()
+	manifest, err := LoadChunkManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// retry the stalled chunk
+	if err = bulkDownload(context.Background(), []string{ts.URL + "/chunk.aac"}, dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("bulkDownload requests => %d, want 2", n)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	limit := MaxRetryDelaySeconds * time.Second
+	for attempt := 1; attempt < 64; attempt++ {
+		upper := retryDelayBase << (attempt - 1)
+		if upper <= 0 || upper > limit {
+			upper = limit
+		}
+		d := backoffDelay(attempt)
+		if d < upper/2 || d > upper {
+			t.Errorf("backoffDelay(%d) => %v, want [%v, %v]", attempt, d, upper/2, upper)
+		}
+	}
+}
+
+func TestBulkDownloadCancel(t *testing.T) {
+	defer func(d time.Duration) { retryDelayBase = d }(retryDelayBase)
+	retryDelayBase = time.Hour
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	manifest, err := LoadChunkManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cancel while waiting for the backoff
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = bulkDownload(ctx, []string{ts.URL + "/chunk.aac"}, dir, manifest)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("bulkDownload => %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCleanTempAACDirs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(EnvRadicronHome, home)
+	history, err := LoadHistory(filepath.Join(home, HistoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := &Prog{ID: "1", StationID: "FMT", Ft: "20230610130000"}
+	audio := filepath.Join(home, "completed.aac")
+	if err = os.WriteFile(audio, []byte("audio"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = history.Record(completed, nil, HistoryStatusCompleted, audio); err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := filepath.Join(home, "tmp")
+	for _, name := range []string{
+		"aac_FMT_20230601130000_2",     // expired
+		"aac_FMT_20230610130000_1",     // completed
+		"aac_JOAK-FM_20230610130000_3", // resumable
+		"aac_FMT_20230601130000_2.aac", // expired
+		"aac_FMT_20230610130000_a_b",   // resumable
+		"aac_invalid",                  // unknown
+		"other",                        // unknown
+	} {
+		if err = os.MkdirAll(filepath.Join(tmp, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2023, 6, 12, 0, 0, 0, 0, Location)
+	if err = CleanTempAACDirs(history, now); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := []string{"aac_FMT_20230610130000_a_b", "aac_JOAK-FM_20230610130000_3", "aac_invalid", "other"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("tmp => %v, want %v", got, want)
+	}
+
+	// without the tmp
+	t.Setenv(EnvRadicronHome, t.TempDir())
+	if err = CleanTempAACDirs(nil, now); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTempAACFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(EnvRadicronHome, home)
+	prog := &Prog{ID: "1", StationID: "FMT", Ft: "20230610130000", Title: strings.Repeat("あ", 100)}
+	got, err := tempAACFile(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same name as the one concatenated in the aac dir, regardless of the title
+	if want := filepath.Join(home, "tmp", "aac_FMT_20230610130000_1.aac"); got != want {
+		t.Errorf("tempAACFile => %s, want %s", got, want)
+	}
+	if _, err = os.Stat(filepath.Dir(got)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,259 @@
+package radicron
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yyoshiki41/radigo"
+)
+
+const (
+	// AudioFormatM4A is AAC in the MP4 container
+	AudioFormatM4A = "m4a"
+	// AudioFormatOpus is Opus in the Ogg container
+	AudioFormatOpus = "opus"
+	// AudioFormatFLAC is the lossless FLAC
+	AudioFormatFLAC = "flac"
+
+	// DefaultLoudnormSampleRate is set with the loudness normalization
+	// since loudnorm upsamples the audio to 192 kHz
+	DefaultLoudnormSampleRate = 48000
+	// DefaultOpusBitrate for the opus file-format
+	DefaultOpusBitrate = "64k"
+	// loudnormFilter is the EBU R128 loudness normalization for the spoken audio
+	loudnormFilter = "loudnorm=I=-16:TP=-1.5:LRA=11"
+)
+
+// bitratePattern matches the bitrate for ffmpeg, e.g., 128k
+var bitratePattern = regexp.MustCompile(`^[1-9][0-9]*k?$`)
+
+// Encoding is the codec settings for the output
+type Encoding struct {
+	Bitrate         string `mapstructure:"bitrate"`          // optional, e.g., 128k
+	ChapterInterval string `mapstructure:"chapter-interval"` // optional, e.g., 10m for the chapters in m4a
+	Loudnorm        bool   `mapstructure:"loudnorm"`         // optional, normalize the loudness
+	Mono            bool   `mapstructure:"mono"`             // optional, downmix to mono
+	SampleRate      int    `mapstructure:"sample-rate"`      // optional, e.g., 48000
+}
+
+// Validate returns an error if the encoding is invalid
+func (e Encoding) Validate() error {
+	if e.Bitrate != "" && !bitratePattern.MatchString(e.Bitrate) {
+		return fmt.Errorf("invalid bitrate '%s'", e.Bitrate)
+	}
+	if e.SampleRate < 0 {
+		return fmt.Errorf("invalid sample-rate '%d'", e.SampleRate)
+	}
+	if e.ChapterInterval != "" {
+		d, err := time.ParseDuration(e.ChapterInterval)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("invalid chapter-interval '%s' (want 1m or longer)", e.ChapterInterval)
+		}
+	}
+	return nil
+}
+
+// IsReencoded returns true if the audio needs to be encoded again
+func (e Encoding) IsReencoded() bool {
+	return e.Bitrate != "" || e.Loudnorm || e.Mono || e.SampleRate != 0
+}
+
+// filterArgs returns the ffmpeg arguments for the sample rate, the channels, and the loudness
+func (e Encoding) filterArgs() []string {
+	args := []string{}
+	sampleRate := e.SampleRate
+	if e.Loudnorm {
+		args = append(args, "-af", loudnormFilter)
+		if sampleRate == 0 {
+			sampleRate = DefaultLoudnormSampleRate
+		}
+	}
+	if sampleRate != 0 {
+		args = append(args, "-ar", strconv.Itoa(sampleRate))
+	}
+	if e.Mono {
+		args = append(args, "-ac", "1")
+	}
+	return args
+}
+
+// Encoder writes the output from the concatenated AAC of the program
+type Encoder interface {
+	Encode(ctx context.Context, input, output string, prog *Prog) error
+}
+
+// NewEncoder returns the Encoder for the file-format with the encoding
+func NewEncoder(fileFormat string, encoding Encoding) (Encoder, error) {
+	if !IsValidAudioFormat(fileFormat) {
+		return nil, fmt.Errorf("unsupported audio format: %s", fileFormat)
+	}
+	if err := encoding.Validate(); err != nil {
+		return nil, err
+	}
+	if fileFormat == radigo.AudioFormatAAC && !encoding.IsReencoded() {
+		return copyEncoder{}, nil
+	}
+	return &ffmpegEncoder{Format: fileFormat, Encoding: encoding}, nil
+}
+
+// copyEncoder moves the AAC as is
+type copyEncoder struct{}
+
+// Encode renames the input to the output
+func (copyEncoder) Encode(ctx context.Context, input, output string, prog *Prog) error {
+	return os.Rename(input, output)
+}
+
+// ffmpegEncoder encodes the output with ffmpeg
+type ffmpegEncoder struct {
+	Format   string
+	Encoding Encoding
+}
+
+// Encode runs ffmpeg for the output with the chapters if any
+func (e *ffmpegEncoder) Encode(ctx context.Context, input, output string, prog *Prog) error {
+	metadata := ""
+	if e.Format == AudioFormatM4A && e.Encoding.ChapterInterval != "" {
+		var err error
+		if metadata, err = writeChapters(filepath.Dir(output), prog, e.Encoding.ChapterInterval); err != nil {
+			return err
+		}
+		defer os.Remove(metadata)
+	}
+	return runFFmpeg(ctx, e.args(input, output, metadata)...)
+}
+
+// args returns the ffmpeg arguments
+func (e *ffmpegEncoder) args(input, output, metadata string) []string {
+	args := []string{"-y", "-i", input}
+	if metadata != "" {
+		args = append(args, "-i", metadata, "-map", "0:a", "-map_chapters", "1")
+	}
+	args = append(args, e.codecArgs()...)
+	if e.Encoding.IsReencoded() {
+		args = append(args, e.Encoding.filterArgs()...)
+	}
+	switch e.Format {
+	case radigo.AudioFormatAAC:
+		args = append(args, "-f", "adts")
+	case AudioFormatM4A:
+		// move the index to the head for seeking
+		args = append(args, "-movflags", "+faststart", "-f", "ipod")
+	default:
+		args = append(args, "-f", e.Format)
+	}
+	return append(args, output)
+}
+
+// codecArgs returns the ffmpeg arguments for the codec of the format
+func (e *ffmpegEncoder) codecArgs() []string {
+	bitrate := e.Encoding.Bitrate
+	switch e.Format {
+	case radigo.AudioFormatMP3:
+		if bitrate == "" {
+			if e.Encoding.Mono {
+				return []string{"-c:a", "libmp3lame", "-q:a", "2"}
+			}
+			// the same as radigo.ConvertAACtoMP3
+			return []string{"-c:a", "libmp3lame", "-ac", "2", "-q:a", "2"}
+		}
+		return []string{"-c:a", "libmp3lame", "-b:a", bitrate}
+	case AudioFormatOpus:
+		if bitrate == "" {
+			bitrate = DefaultOpusBitrate
+		}
+		return []string{"-c:a", "libopus", "-b:a", bitrate}
+	case AudioFormatFLAC:
+		return []string{"-c:a", "flac"}
+	default: // AAC and M4A
+		if !e.Encoding.IsReencoded() {
+			return []string{"-c:a", "copy"}
+		}
+		if bitrate == "" {
+			return []string{"-c:a", "aac"}
+		}
+		return []string{"-c:a", "aac", "-b:a", bitrate}
+	}
+}
+
+// writeChapters writes the ffmetadata with the chapters at the interval in the dir
+// and returns the path
+func writeChapters(dir string, prog *Prog, interval string) (string, error) {
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return "", err
+	}
+	duration, err := prog.Duration()
+	if err != nil {
+		return "", err
+	}
+	return writeTemp(dir, ".chapters-*.txt", chapterMetadata(prog.Title, duration, d))
+}
+
+// chapterMetadata returns the ffmetadata with the chapters at the interval
+func chapterMetadata(title string, duration, interval time.Duration) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	escaped := escapeFFMetadata(title)
+	for i, start := 1, time.Duration(0); start < duration; i, start = i+1, start+interval {
+		end := start + interval
+		if end > duration {
+			end = duration
+		}
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s %d\n",
+			start.Milliseconds(), end.Milliseconds(), escaped, i)
+	}
+	return b.String()
+}
+
+// escapeFFMetadata escapes the special characters in the ffmetadata values
+func escapeFFMetadata(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", `\`+"\n").Replace(s)
+}
+
+// tempName returns the path of a new empty file in the dir with a short name,
+// since the name of the output may already be at max-filename-bytes
+func tempName(dir, pattern string) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// writeTemp writes the text to a new file in the dir with a short name and returns the path
+func writeTemp(dir, pattern, text string) (string, error) {
+	path, err := tempName(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(path, []byte(text), 0o600); err != nil { //nolint:gomnd
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// runFFmpeg runs ffmpeg with the arguments and returns the error with the last line of the log
+func runFFmpeg(ctx context.Context, args ...string) error {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...) //nolint:gosec
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return fmt.Errorf("ffmpeg %s: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package radicron
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var encodertests = []struct {
+	name     string
+	format   string
+	encoding Encoding
+	args     string
+}{
+	{
+		"mp3 as radigo",
+		"mp3",
+		Encoding{},
+		"-y -i in.aac -c:a libmp3lame -ac 2 -q:a 2 -f mp3 out",
+	},
+	{
+		"mp3 in mono",
+		"mp3",
+		Encoding{Mono: true},
+		"-y -i in.aac -c:a libmp3lame -q:a 2 -ac 1 -f mp3 out",
+	},
+	{
+		"mp3 with bitrate",
+		"mp3",
+		Encoding{Bitrate: "96k", Mono: true},
+		"-y -i in.aac -c:a libmp3lame -b:a 96k -ac 1 -f mp3 out",
+	},
+	{
+		"aac with loudnorm",
+		"aac",
+		Encoding{Loudnorm: true},
+		"-y -i in.aac -c:a aac -af loudnorm=I=-16:TP=-1.5:LRA=11 -ar 48000 -f adts out",
+	},
+	{
+		"m4a remux",
+		"m4a",
+		Encoding{},
+		"-y -i in.aac -c:a copy -movflags +faststart -f ipod out",
+	},
+	{
+		"m4a with bitrate and sample rate",
+		"m4a",
+		Encoding{Bitrate: "64k", SampleRate: 44100},
+		"-y -i in.aac -c:a aac -b:a 64k -ar 44100 -movflags +faststart -f ipod out",
+	},
+	{
+		"opus",
+		"opus",
+		Encoding{Mono: true},
+		"-y -i in.aac -c:a libopus -b:a 64k -ac 1 -f opus out",
+	},
+	{
+		"flac",
+		"flac",
+		Encoding{SampleRate: 48000},
+		"-y -i in.aac -c:a flac -ar 48000 -f flac out",
+	},
+}
+
+func TestNewEncoder(t *testing.T) {
+	for _, tt := range encodertests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewEncoder(tt.format, tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, ok := encoder.(*ffmpegEncoder)
+			if !ok {
+				t.Fatalf("NewEncoder => %T, want *ffmpegEncoder", encoder)
+			}
+			if got := strings.Join(e.args("in.aac", "out", ""), " "); got != tt.args {
+				t.Errorf("args => %s, want %s", got, tt.args)
+			}
+		})
+	}
+
+	if _, err := NewEncoder("wav", Encoding{}); err == nil {
+		t.Error("NewEncoder should fail with wav")
+	}
+	for _, encoding := range []Encoding{
+		{Bitrate: "fast"},
+		{SampleRate: -1},
+		{ChapterInterval: "10"},
+		{ChapterInterval: "1s"},
+	} {
+		if _, err := NewEncoder("m4a", encoding); err == nil {
+			t.Errorf("NewEncoder should fail with %+v", encoding)
+		}
+	}
+}
+
+func TestCopyEncoder(t *testing.T) {
+	encoder, err := NewEncoder("aac", Encoding{ChapterInterval: "10m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.aac")
+	output := filepath.Join(dir, "out.aac")
+	if err = os.WriteFile(input, adtsFrame("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = encoder.Encode(context.Background(), input, output, &Prog{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(output); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChapterMetadata(t *testing.T) {
+	got := chapterMetadata("a=b", 25*time.Minute, 10*time.Minute)
+	want := `;FFMETADATA1
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=600000
+title=a\=b 1
+[CHAPTER]
+TIMEBASE=1/1000
+START=600000
+END=1200000
+title=a\=b 2
+[CHAPTER]
+TIMEBASE=1/1000
+START=1200000
+END=1500000
+title=a\=b 3
+`
+	if got != want {
+		t.Errorf("chapterMetadata => %s, want %s", got, want)
+	}
+
+	// with the chapters
+	e := &ffmpegEncoder{Format: AudioFormatM4A, Encoding: Encoding{ChapterInterval: "10m"}}
+	args := strings.Join(e.args("in.aac", "out", "chapters.txt"), " ")
+	if !strings.Contains(args, "-i chapters.txt -map 0:a -map_chapters 1") {
+		t.Errorf("args => %s, want the chapters", args)
+	}
+}
@@ -0,0 +1,338 @@
+package radicron
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expr is a compiled boolean rule expression
+//
+//	expr      = term { "or" term }
+//	term      = factor { "and" factor }
+//	factor    = "not" factor | "(" expr ")" | predicate
+//	predicate = field op value
+//
+// the field is one of title, pfm, desc, info, tags, genre, station, dow, or time,
+// and the op is ':' (contains), '=' (equals), or '~' (regular expression);
+// time also accepts '<', '<=', '>', and '>=' with an "HH:MM" value,
+// where 00:00-04:59 is treated as 24:00-28:59 of the previous broadcast day.
+// the value can be double- or single-quoted if it contains spaces or parentheses.
+// unless exact, ':' and '=' ignore the differences folded by Normalize.
+type Expr interface {
+	Eval(stationID string, p *Prog) bool
+}
+
+type andExpr struct {
+	left, right Expr
+}
+
+func (e *andExpr) Eval(stationID string, p *Prog) bool {
+	return e.left.Eval(stationID, p) && e.right.Eval(stationID, p)
+}
+
+type orExpr struct {
+	left, right Expr
+}
+
+func (e *orExpr) Eval(stationID string, p *Prog) bool {
+	return e.left.Eval(stationID, p) || e.right.Eval(stationID, p)
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+func (e *notExpr) Eval(stationID string, p *Prog) bool {
+	return !e.expr.Eval(stationID, p)
+}
+
+// predicateExpr compares a field of the program with the value
+type predicateExpr struct {
+	field   string
+	op      string
+	value   string
+	exact   bool
+	re      *regexp.Regexp
+	minutes int
+}
+
+func (e *predicateExpr) Eval(stationID string, p *Prog) bool {
+	switch e.field {
+	case "time":
+		return e.compareTime(p.Ft)
+	case "dow":
+		st, err := time.ParseInLocation(DatetimeLayout, p.Ft, Location)
+		if err != nil {
+			return false
+		}
+		return st.Weekday() == weekdays[strings.ToLower(e.value)]
+	}
+	for _, s := range e.fieldValues(stationID, p) {
+		if e.matchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *predicateExpr) compareTime(ft string) bool {
+	m, err := BroadcastMinutes(ft)
+	if err != nil {
+		return false
+	}
+	switch e.op {
+	case "<":
+		return m < e.minutes
+	case "<=":
+		return m <= e.minutes
+	case ">":
+		return m > e.minutes
+	case ">=":
+		return m >= e.minutes
+	default:
+		return m == e.minutes
+	}
+}
+
+func (e *predicateExpr) fieldValues(stationID string, p *Prog) []string {
+	switch e.field {
+	case "title":
+		return []string{p.Title}
+	case "pfm":
+		return []string{p.Pfm}
+	case "desc":
+		return []string{p.Desc}
+	case "info":
+		return []string{p.Info}
+	case "tags":
+		return p.Tags
+	case "genre":
+		return []string{p.Genre.Personality, p.Genre.PersonalityID, p.Genre.Program, p.Genre.ProgramID}
+	case "station":
+		return []string{stationID}
+	}
+	return nil
+}
+
+func (e *predicateExpr) matchString(s string) bool {
+	switch e.op {
+	case "=":
+		return equalText(s, e.value, e.exact)
+	case "~":
+		return e.re.MatchString(s)
+	default:
+		return containsText(s, e.value, e.exact)
+	}
+}
+
+// ParseExpr compiles the expression string
+func ParseExpr(s string, exact bool) (Expr, error) {
+	ep := &exprParser{input: []rune(s), exact: exact}
+	e, err := ep.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	ep.skipSpace()
+	if !ep.eof() {
+		return nil, fmt.Errorf("unexpected '%s' at %d", string(ep.input[ep.pos:]), ep.pos)
+	}
+	return e, nil
+}
+
+type exprParser struct {
+	input []rune
+	pos   int
+	exact bool
+}
+
+func (ep *exprParser) eof() bool {
+	return ep.pos >= len(ep.input)
+}
+
+func (ep *exprParser) skipSpace() {
+	for !ep.eof() && unicode.IsSpace(ep.input[ep.pos]) {
+		ep.pos++
+	}
+}
+
+// acceptKeyword consumes the keyword if it is the next word
+func (ep *exprParser) acceptKeyword(kw string) bool {
+	ep.skipSpace()
+	end := ep.pos + len(kw)
+	if end > len(ep.input) || !strings.EqualFold(string(ep.input[ep.pos:end]), kw) {
+		return false
+	}
+	if end < len(ep.input) && !unicode.IsSpace(ep.input[end]) && ep.input[end] != '(' {
+		return false // a prefix of another word
+	}
+	ep.pos = end
+	return true
+}
+
+func (ep *exprParser) parseOr() (Expr, error) {
+	left, err := ep.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for ep.acceptKeyword("or") {
+		right, err := ep.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (ep *exprParser) parseAnd() (Expr, error) {
+	left, err := ep.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for ep.acceptKeyword("and") {
+		right, err := ep.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (ep *exprParser) parseNot() (Expr, error) {
+	if ep.acceptKeyword("not") {
+		e, err := ep.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{e}, nil
+	}
+	ep.skipSpace()
+	if !ep.eof() && ep.input[ep.pos] == '(' {
+		ep.pos++
+		e, err := ep.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		ep.skipSpace()
+		if ep.eof() || ep.input[ep.pos] != ')' {
+			return nil, fmt.Errorf("missing ')' at %d", ep.pos)
+		}
+		ep.pos++
+		return e, nil
+	}
+	return ep.parsePredicate()
+}
+
+func (ep *exprParser) parsePredicate() (Expr, error) {
+	ep.skipSpace()
+	start := ep.pos
+	for !ep.eof() && (unicode.IsLetter(ep.input[ep.pos]) || ep.input[ep.pos] == '-') {
+		ep.pos++
+	}
+	field := strings.ToLower(string(ep.input[start:ep.pos]))
+	if field == "" {
+		return nil, fmt.Errorf("missing a field at %d", start)
+	}
+	if field == "tag" {
+		field = "tags"
+	}
+
+	ep.skipSpace()
+	opStart := ep.pos
+	for !ep.eof() && strings.ContainsRune(":=~<>", ep.input[ep.pos]) {
+		ep.pos++
+	}
+	op := string(ep.input[opStart:ep.pos])
+
+	ep.skipSpace()
+	value, err := ep.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return newPredicateExpr(field, op, value, ep.exact)
+}
+
+func (ep *exprParser) parseValue() (string, error) {
+	if ep.eof() {
+		return "", fmt.Errorf("missing a value at %d", ep.pos)
+	}
+	if q := ep.input[ep.pos]; q == '"' || q == '\'' {
+		start := ep.pos + 1
+		for ep.pos = start; !ep.eof(); ep.pos++ {
+			if ep.input[ep.pos] == q {
+				ep.pos++
+				return string(ep.input[start : ep.pos-1]), nil
+			}
+		}
+		return "", fmt.Errorf("missing a closing %c at %d", q, ep.pos)
+	}
+	start := ep.pos
+	for !ep.eof() && !unicode.IsSpace(ep.input[ep.pos]) && ep.input[ep.pos] != '(' && ep.input[ep.pos] != ')' {
+		ep.pos++
+	}
+	if start == ep.pos {
+		return "", fmt.Errorf("missing a value at %d", ep.pos)
+	}
+	return string(ep.input[start:ep.pos]), nil
+}
+
+func newPredicateExpr(field, op, value string, exact bool) (*predicateExpr, error) {
+	e := &predicateExpr{field: field, op: op, value: value, exact: exact}
+	switch field {
+	case "time":
+		switch op {
+		case ":", "=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("invalid operator '%s' for %s", op, field)
+		}
+		m, err := parseClock(value)
+		if err != nil {
+			return nil, err
+		}
+		e.minutes = toBroadcastMinutes(m)
+	case "dow":
+		if op != ":" && op != "=" {
+			return nil, fmt.Errorf("invalid operator '%s' for %s", op, field)
+		}
+		if _, ok := weekdays[strings.ToLower(value)]; !ok {
+			return nil, fmt.Errorf("invalid day of the week '%s'", value)
+		}
+	case "title", "pfm", "desc", "info", "tags", "genre", "station":
+		switch op {
+		case ":", "=":
+		case "~":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+			e.re = re
+		default:
+			return nil, fmt.Errorf("invalid operator '%s' for %s", op, field)
+		}
+	default:
+		return nil, fmt.Errorf("unknown field '%s'", field)
+	}
+	return e, nil
+}
+
+// parseClock returns the minutes of the day for "HH:MM" up to 29:00
+func parseClock(s string) (int, error) {
+	hm := strings.SplitN(s, ":", 2)
+	if len(hm) != 2 {
+		return 0, fmt.Errorf("invalid time '%s' (want HH:MM)", s)
+	}
+	h, err := strconv.Atoi(hm[0])
+	if err != nil || h < 0 || h > BroadcastDayStartHour+OneDay {
+		return 0, fmt.Errorf("invalid hour in '%s'", s)
+	}
+	m, err := strconv.Atoi(hm[1])
+	if err != nil || m < 0 || m > 59 || h*60+m > (BroadcastDayStartHour+OneDay)*60 {
+		return 0, fmt.Errorf("invalid minute in '%s'", s)
+	}
+	return h*60 + m, nil
+}
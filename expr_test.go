@@ -0,0 +1,112 @@
+package radicron
+
+import (
+	"testing"
+)
+
+var exprtests = []struct {
+	in        string
+	stationID string
+	p         *Prog
+	out       bool
+}{
+	{
+		`title:"THE TRAD"`,
+		"FMT",
+		&Prog{Title: "THE TRAD"},
+		true,
+	},
+	{
+		`title: "THE TRAD" and station = FMT and time >= 05:00`, // spaces around the operator
+		"FMT",
+		&Prog{Title: "THE TRAD", Ft: "20230625150000"},
+		true,
+	},
+	{
+		`(pfm:稲垣吾郎 or pfm:ハマ・オカモト) and station=FMT and not title:ベスト`,
+		"FMT",
+		&Prog{Title: "THE TRAD", Pfm: "ハマ・オカモト"},
+		true,
+	},
+	{
+		`(pfm:稲垣吾郎 or pfm:ハマ・オカモト) and station=FMT and not title:ベスト`,
+		"FMT",
+		&Prog{Title: "THE TRAD ベスト", Pfm: "稲垣吾郎"},
+		false,
+	},
+	{
+		`(pfm:稲垣吾郎 or pfm:ハマ・オカモト) and station=FMT and not title:ベスト`,
+		"TBS",
+		&Prog{Title: "THE TRAD", Pfm: "稲垣吾郎"},
+		false,
+	},
+	{
+		`pfm:A or pfm:B and station=TBS`, // and binds tighter than or
+		"FMT",
+		&Prog{Pfm: "A"},
+		true,
+	},
+	{
+		`NOT (tags:作業 OR genre=トーク)`,
+		"FMT",
+		&Prog{Tags: []string{"作業がはかどる"}, Genre: ProgGenre{Program: "音楽"}},
+		false,
+	},
+	{
+		`genre=トーク and info:MAZZEL and desc~^$`,
+		"FMT",
+		&Prog{Info: "ゲストはMAZZEL", Genre: ProgGenre{Program: "トーク"}},
+		true,
+	},
+	{
+		`dow:sun and time>=05:00 and time<06:00`,
+		"FMT",
+		&Prog{Ft: "20230625050000"}, // sun
+		true,
+	},
+	{
+		`dow:mon or time>05:00`,
+		"FMT",
+		&Prog{Ft: "20230625050000"}, // sun
+		false,
+	},
+}
+
+func TestParseExpr(t *testing.T) {
+	for _, tt := range exprtests {
+		e, err := ParseExpr(tt.in, false)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) => %v", tt.in, err)
+			continue
+		}
+		got := e.Eval(tt.stationID, tt.p)
+		if got != tt.out {
+			t.Errorf("ParseExpr(%q).Eval => %v, want %v", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestParseExprError(t *testing.T) {
+	var exprerrortests = []string{
+		``,
+		`title`,
+		`title:`,
+		`title: `,
+		`title A`,
+		`(title:A`,
+		`title:A)`,
+		`title:A and`,
+		`channel:FMT`,
+		`title<A`,
+		`title~(`,
+		`dow:someday`,
+		`time:29:30`,
+		`time~05:00`,
+		`title:"unclosed`,
+	}
+	for _, in := range exprerrortests {
+		if _, err := ParseExpr(in, false); err == nil {
+			t.Errorf("ParseExpr(%q) => nil, want an error", in)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package radicron
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yyoshiki41/radigo"
+)
+
+const (
+	// DefaultFeedTitle is the title of the combined feed
+	DefaultFeedTitle = "radicron"
+	// FeedFileName for the combined feed in the downloads
+	FeedFileName = "feed.xml"
+	// FeedDir for the feeds per rule in the downloads
+	FeedDir = "feeds"
+)
+
+// feedMu serializes the feed generation from the concurrent downloads
+var feedMu sync.Mutex
+
+// feedMIMETypes are the enclosure types for the file-formats
+var feedMIMETypes = map[string]string{
+	radigo.AudioFormatAAC: "audio/aac",
+	radigo.AudioFormatMP3: "audio/mpeg",
+	AudioFormatM4A:        "audio/x-m4a",
+	AudioFormatOpus:       "audio/ogg",
+	AudioFormatFLAC:       "audio/flac",
+}
+
+// FeedConfig is the podcast feed settings
+type FeedConfig struct {
+	BaseURL string `mapstructure:"base-url"` // the URL of the downloads, the feeds are disabled if empty
+	Title   string `mapstructure:"title"`    // optional, default to DefaultFeedTitle
+}
+
+// IsEnabled returns true if the feeds are generated
+func (c *FeedConfig) IsEnabled() bool {
+	return c.BaseURL != ""
+}
+
+// Validate returns an error if the feed settings are invalid
+func (c *FeedConfig) Validate() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid base-url '%s'", c.BaseURL)
+	}
+	return nil
+}
+
+// RSS is the RSS 2.0 feed with the iTunes extensions
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+// RSSChannel is the podcast
+type RSSChannel struct {
+	Title          string    `xml:"title"`
+	Link           string    `xml:"link"`
+	Description    string    `xml:"description"`
+	Language       string    `xml:"language"`
+	LastBuildDate  string    `xml:"lastBuildDate"`
+	ITunesAuthor   string    `xml:"itunes:author"`
+	ITunesExplicit string    `xml:"itunes:explicit"`
+	Items          []RSSItem `xml:"item"`
+}
+
+// RSSItem is the episode
+type RSSItem struct {
+	Title          string       `xml:"title"`
+	Description    string       `xml:"description"`
+	PubDate        string       `xml:"pubDate"`
+	GUID           RSSGUID      `xml:"guid"`
+	Enclosure      RSSEnclosure `xml:"enclosure"`
+	ITunesAuthor   string       `xml:"itunes:author,omitempty"`
+	ITunesDuration string       `xml:"itunes:duration,omitempty"`
+	ITunesImage    *ITunesImage `xml:"itunes:image,omitempty"`
+}
+
+// RSSGUID is the unique ID of the episode
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSSEnclosure is the audio file of the episode
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// ITunesImage is the artwork of the episode
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// GenerateFeeds writes the feed per rule in the feeds dir and the combined feed
+// in the downloads from the programs completed in the history
+func GenerateFeeds(asset *Asset) error {
+	if asset == nil || asset.History == nil || !asset.Feed.IsEnabled() {
+		return nil
+	}
+	feedMu.Lock()
+	defer feedMu.Unlock()
+
+	downloads, err := getRadicronPath("downloads")
+	if err != nil {
+		return err
+	}
+	title := asset.Feed.Title
+	if title == "" {
+		title = DefaultFeedTitle
+	}
+
+	// the newest first
+	all := []RSSItem{}
+	rules := map[string][]RSSItem{}
+	recs := asset.History.Records()
+	for i := len(recs) - 1; i >= 0; i-- {
+		rec := recs[i]
+		if rec.Status != HistoryStatusCompleted {
+			continue
+		}
+		if _, err = os.Stat(rec.Path); err != nil {
+			continue // removed by the user
+		}
+		item, err := newRSSItem(asset, rec, downloads)
+		if err != nil {
+			log.Printf("feed: %s", err)
+			continue
+		}
+		all = append(all, item)
+		if rec.Rule != "" && rec.Rule != NoRuleName {
+			rules[rec.Rule] = append(rules[rec.Rule], item)
+		}
+	}
+
+	if err = writeFeed(filepath.Join(downloads, FeedFileName), asset.Feed.BaseURL, title, all); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(downloads, FeedDir, feedFileName(asset.Sanitizer, name))
+		if err = writeFeed(path, asset.Feed.BaseURL, title+" - "+name, rules[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newRSSItem returns the episode for the record of the file in the downloads
+func newRSSItem(asset *Asset, rec *HistoryRecord, downloads string) (RSSItem, error) {
+	prog := rec.Prog
+	rel, err := filepath.Rel(downloads, rec.Path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return RSSItem{}, fmt.Errorf("the file '%s' is not in the downloads", rec.Path)
+	}
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+	for i, e := range elems {
+		elems[i] = url.PathEscape(e)
+	}
+
+	item := RSSItem{
+		Title:       prog.Title,
+		Description: prog.Desc,
+		GUID:        RSSGUID{Value: rec.Key},
+		Enclosure: RSSEnclosure{
+			URL:    strings.TrimSuffix(asset.Feed.BaseURL, "/") + "/" + strings.Join(elems, "/"),
+			Length: rec.Size,
+			Type:   feedMIMETypes[strings.TrimPrefix(filepath.Ext(rec.Path), ".")],
+		},
+		ITunesAuthor: prog.Pfm,
+	}
+	if ft, err := time.ParseInLocation(DatetimeLayout, prog.Ft, Location); err == nil {
+		item.Title = fmt.Sprintf("%s (%s)", prog.Title, ft.Format("2006-01-02"))
+		item.PubDate = ft.Format(time.RFC1123Z)
+	}
+	if d, err := prog.Duration(); err == nil {
+		item.ITunesDuration = strconv.Itoa(int(d.Seconds()))
+	}
+	if img := CoverImageURL(asset, prog); img != "" {
+		item.ITunesImage = &ITunesImage{Href: img}
+	}
+	return item, nil
+}
+
+// feedFileName returns the file name of the feed for the rule
+func feedFileName(sanitizer Sanitizer, rule string) string {
+	maxBytes := sanitizer.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxFilenameBytes
+	}
+	return sanitizer.Element(rule, maxBytes-len(".xml")) + ".xml"
+}
+
+// writeFeed writes the RSS feed to the path
+func writeFeed(path, link, title string, items []RSSItem) error {
+	rss := RSS{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: RSSChannel{
+			Title:          title,
+			Link:           link,
+			Description:    fmt.Sprintf("The programs downloaded by %s", title),
+			Language:       "ja",
+			LastBuildDate:  time.Now().In(Location).Format(time.RFC1123Z),
+			ITunesAuthor:   DefaultFeedTitle,
+			ITunesExplicit: "false",
+			Items:          items,
+		},
+	}
+	blob, err := xml.MarshalIndent(rss, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gomnd
+		return err
+	}
+	// replace the feed at once for the clients
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, append([]byte(xml.Header), blob...), 0o644); err != nil { //nolint:gomnd,gosec
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,135 @@
+package radicron
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateFeeds(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(EnvRadicronHome, home)
+	history, err := LoadHistory(filepath.Join(home, HistoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloads := filepath.Join(home, "downloads")
+	if err = os.MkdirAll(filepath.Join(downloads, "rule a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		prog   Prog
+		rule   *Rule
+		status string
+		path   string
+	}{
+		{Prog{StationID: "FMT", Ft: "20230605130000", To: "20230605145500", Title: "older", Pfm: "pfm"},
+			&Rule{Name: "rule/a"}, HistoryStatusCompleted, "rule a/older.m4a"},
+		{Prog{StationID: "FMT", Ft: "20230606130000", To: "20230606140000", Title: "newer", Desc: "desc", Img: "https://example.com/img.jpg"},
+			&Rule{Name: "rule/a"}, HistoryStatusCompleted, "rule a/newer #1.m4a"},
+		{Prog{StationID: "TBS", Ft: "20230606150000", To: "20230606160000", Title: "other"},
+			&Rule{Name: "rule-b"}, HistoryStatusFailed, "other.mp3"},
+		{Prog{StationID: "TBS", Ft: "20230607150000", To: "20230607160000", Title: "no rule"},
+			nil, HistoryStatusCompleted, "norule.mp3"},
+	} {
+		prog := tt.prog
+		path := filepath.Join(downloads, tt.path)
+		if err = os.WriteFile(path, []byte("audio"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err = history.Record(&prog, tt.rule, tt.status, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	asset := &Asset{History: history}
+	// disabled
+	if err = GenerateFeeds(asset); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(downloads, FeedFileName)); !os.IsNotExist(err) {
+		t.Error("the feed should not be generated without the base-url")
+	}
+
+	asset.Feed = FeedConfig{BaseURL: "https://example.com/radiko/"}
+	if err = GenerateFeeds(asset); err != nil {
+		t.Fatal(err)
+	}
+
+	all := readFeed(t, filepath.Join(downloads, FeedFileName))
+	if all.Channel.Title != DefaultFeedTitle || len(all.Channel.Items) != 3 {
+		t.Fatalf("feed => %s with %d items, want %s with 3 items", all.Channel.Title, len(all.Channel.Items), DefaultFeedTitle)
+	}
+	if got := all.Channel.Items[0].Title; got != "no rule (2023-06-07)" {
+		t.Errorf("the first item => %s, want the newest", got)
+	}
+
+	rule := readFeed(t, filepath.Join(downloads, FeedDir, "rule／a.xml"))
+	if len(rule.Channel.Items) != 2 {
+		t.Fatalf("rule feed => %d items, want 2", len(rule.Channel.Items))
+	}
+	item := rule.Channel.Items[0]
+	want := RSSItem{
+		Title:       "newer (2023-06-06)",
+		Description: "desc",
+		PubDate:     "Tue, 06 Jun 2023 13:00:00 +0900",
+		GUID:        RSSGUID{Value: "FMT_20230606130000_"},
+		Enclosure: RSSEnclosure{
+			URL:    "https://example.com/radiko/rule%20a/newer%20%231.m4a",
+			Length: 5,
+			Type:   "audio/x-m4a",
+		},
+	}
+	if item.Title != want.Title || item.Description != want.Description || item.PubDate != want.PubDate ||
+		item.GUID != want.GUID || item.Enclosure != want.Enclosure {
+		t.Errorf("item => %+v, want %+v", item, want)
+	}
+	// the decoder does not map the prefixed names back
+	blob, err := os.ReadFile(filepath.Join(downloads, FeedDir, "rule／a.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">`,
+		"<itunes:duration>3600</itunes:duration>",
+		`<itunes:image href="https://example.com/img.jpg"></itunes:image>`,
+		"<itunes:author>pfm</itunes:author>",
+	} {
+		if !strings.Contains(string(blob), want) {
+			t.Errorf("feed => %s, want %s", blob, want)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(downloads, FeedDir, "rule-b.xml")); !os.IsNotExist(err) {
+		t.Error("the feed should not be generated for the rule without the completed programs")
+	}
+}
+
+func TestFeedConfigValidate(t *testing.T) {
+	for _, c := range []FeedConfig{{}, {BaseURL: "http://localhost:8080/radiko"}} {
+		if err := c.Validate(); err != nil {
+			t.Errorf("Validate(%+v) => %v", c, err)
+		}
+	}
+	for _, c := range []FeedConfig{{BaseURL: "radiko"}, {BaseURL: "ftp://example.com"}, {BaseURL: "https://"}} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", c)
+		}
+	}
+}
+
+// readFeed parses the feed at the path
+func readFeed(t *testing.T, path string) *RSS {
+	t.Helper()
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rss := &RSS{}
+	if err = xml.Unmarshal(blob, rss); err != nil {
+		t.Fatal(err)
+	}
+	return rss
+}
@@ -9,6 +9,8 @@ require (
 	github.com/spf13/viper v1.15.0
 	github.com/yyoshiki41/go-radiko v0.9.0
 	github.com/yyoshiki41/radigo v0.12.0
+	golang.org/x/net v0.4.0
+	golang.org/x/text v0.5.0
 )
 
 require (
@@ -46,9 +48,7 @@ require (
 	github.com/stretchr/testify v1.8.2 // indirect
 	github.com/subosito/gotenv v1.4.2 // indirect
 	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e // indirect
-	golang.org/x/net v0.4.0 // indirect
 	golang.org/x/sys v0.8.0 // indirect
-	golang.org/x/text v0.5.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,247 @@
+package radicron
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// HistoryStatusDownloading is set when the download starts
+	HistoryStatusDownloading = "downloading"
+	// HistoryStatusCompleted is set when the output file is saved
+	HistoryStatusCompleted = "completed"
+	// HistoryStatusFailed is set when the download failed and should be retried
+	HistoryStatusFailed = "failed"
+	// HistoryStatusInterrupted is set for the downloads not finished in the previous run
+	HistoryStatusInterrupted = "interrupted"
+)
+
+// HistoryRecord is a line in the history ledger
+type HistoryRecord struct {
+	Key       string    `json:"key"`
+	Status    string    `json:"status"`
+	Rule      string    `json:"rule,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Checksum  string    `json:"checksum,omitempty"` // sha256
+	UpdatedAt time.Time `json:"updated_at"`
+	Prog      *Prog     `json:"prog"`
+}
+
+// History is the persistent download history in a JSONL ledger,
+// where the last record for each key wins
+type History struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]*HistoryRecord
+}
+
+// HistoryKey returns the key for the program
+func HistoryKey(prog *Prog) string {
+	return fmt.Sprintf("%s_%s_%s", prog.StationID, prog.Ft, prog.ID)
+}
+
+// OpenHistory loads the history ledger in RADICRON_HOME
+func OpenHistory() (*History, error) {
+	path, err := getRadicronPath(HistoryFileName)
+	if err != nil {
+		return nil, err
+	}
+	return LoadHistory(path)
+}
+
+// LoadHistory loads the history ledger from the path and compacts it if needed
+func LoadHistory(path string) (*History, error) {
+	h := &History{
+		path:    path,
+		records: map[string]*HistoryRecord{},
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, Kilobytes*Kilobytes), Kilobytes*Kilobytes)
+	for scanner.Scan() {
+		lines++
+		rec := &HistoryRecord{}
+		if err = json.Unmarshal(scanner.Bytes(), rec); err != nil || rec.Key == "" || rec.Prog == nil {
+			log.Printf("skip an invalid history record at %s:%d", path, lines)
+			continue
+		}
+		// the downloads in progress were interrupted in the previous run
+		if rec.Status == HistoryStatusDownloading {
+			rec.Status = HistoryStatusInterrupted
+		}
+		h.records[rec.Key] = rec
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if lines > len(h.records)*2 {
+		if err = h.compact(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Get returns the latest record for the program
+func (h *History) Get(prog *Prog) (*HistoryRecord, bool) {
+	if h == nil {
+		return nil, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec, ok := h.records[HistoryKey(prog)]
+	return rec, ok
+}
+
+// IsDone returns true if the program is already downloaded or being downloaded
+func (h *History) IsDone(prog *Prog) bool {
+	if h == nil {
+		return false
+	}
+	rec, ok := h.Get(prog)
+	if !ok {
+		return false
+	}
+	return rec.Status == HistoryStatusCompleted || rec.Status == HistoryStatusDownloading
+}
+
+// Record appends the record for the program to the ledger
+func (h *History) Record(prog *Prog, rule *Rule, status, path string) error {
+	if h == nil {
+		return nil
+	}
+	rec := &HistoryRecord{
+		Key:       HistoryKey(prog),
+		Status:    status,
+		Rule:      rule.GetName(),
+		Path:      path,
+		UpdatedAt: time.Now().In(Location),
+		Prog:      prog,
+	}
+	if status == HistoryStatusCompleted {
+		size, checksum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		rec.Size = size
+		rec.Checksum = checksum
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.append(rec); err != nil {
+		return err
+	}
+	h.records[rec.Key] = rec
+	return nil
+}
+
+// Records returns the latest records in the order of the start time
+func (h *History) Records() []*HistoryRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	recs := make([]*HistoryRecord, 0, len(h.records))
+	for _, rec := range h.records {
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Prog.Ft != recs[j].Prog.Ft {
+			return recs[i].Prog.Ft < recs[j].Prog.Ft
+		}
+		return recs[i].Key < recs[j].Key
+	})
+	return recs
+}
+
+// Episode returns the episode number of the program in the series,
+// i.e., the programs with the same title on the same station completed before it plus one
+func (h *History) Episode(prog *Prog) int {
+	if h == nil {
+		return 0
+	}
+	episode := 1
+	for _, rec := range h.Records() {
+		if rec.Status == HistoryStatusCompleted && rec.Key != HistoryKey(prog) &&
+			rec.Prog.StationID == prog.StationID && rec.Prog.Title == prog.Title && rec.Prog.Ft < prog.Ft {
+			episode++
+		}
+	}
+	return episode
+}
+
+// append writes a line to the ledger
+func (h *History) append(rec *HistoryRecord) error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil { //nolint:gomnd
+		return err
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644) //nolint:gomnd
+	if err != nil {
+		return err
+	}
+	blob, err := json.Marshal(rec)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	_, err = file.Write(append(blob, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// compact rewrites the ledger with the latest records only
+func (h *History) compact() error {
+	tmp := h.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	for _, rec := range h.Records() {
+		if err = enc.Encode(rec); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// fileChecksum returns the size and the sha256 checksum of the file
+func fileChecksum(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,138 @@
+package radicron
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var historyProg = &Prog{
+	ID:        "12345",
+	StationID: "FMT",
+	Ft:        "20230605130000",
+	To:        "20230605145500",
+	Title:     "sample",
+}
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, HistoryFileName)
+	audio := filepath.Join(dir, "sample.aac")
+	if err := os.WriteFile(audio, []byte("audio"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.IsDone(historyProg) {
+		t.Error("empty history should not have the program")
+	}
+	if err = h.Record(historyProg, &Rule{Name: "rule"}, HistoryStatusDownloading, audio); err != nil {
+		t.Fatal(err)
+	}
+	if !h.IsDone(historyProg) {
+		t.Error("downloading program should be done")
+	}
+
+	// the download in progress is interrupted after the reload
+	h, err = LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, ok := h.Get(historyProg)
+	if !ok || rec.Status != HistoryStatusInterrupted {
+		t.Errorf("reloaded record => %v, want %s", rec, HistoryStatusInterrupted)
+	}
+	if h.IsDone(historyProg) {
+		t.Error("interrupted program should not be done")
+	}
+
+	if err = h.Record(historyProg, nil, HistoryStatusFailed, audio); err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Record(historyProg, nil, HistoryStatusCompleted, audio); err != nil {
+		t.Fatal(err)
+	}
+	rec, _ = h.Get(historyProg)
+	// sha256 of "audio"
+	want := "6ed8919ce20490a5e3ad8630a4fab69475297abd07db73918dd5f36fcfaeb11b"
+	if rec.Size != 5 || rec.Checksum != want || rec.Rule != NoRuleName {
+		t.Errorf("completed record => %+v", rec)
+	}
+
+	// the ledger is compacted when it has too many stale lines
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(blob), "\n"); n != 3 {
+		t.Errorf("ledger lines => %d, want 3", n)
+	}
+	h, err = LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(blob), "\n"); n != 1 {
+		t.Errorf("compacted ledger lines => %d, want 1", n)
+	}
+	if !h.IsDone(historyProg) || len(h.Records()) != 1 {
+		t.Error("completed program should be done after the compaction")
+	}
+}
+
+func TestLoadHistoryInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFileName)
+	lines := strings.Join([]string{
+		`{"key":"FMT_20230605130000_12345","status":"completed","prog":{"StationID":"FMT","Ft":"20230605130000"}}`,
+		`{"key":"FMT_20230606130000_","status":"completed","prog":null}`,
+		`{"key":"FMT_20230607130000_","status":"completed"}`,
+		`{"status":"completed","prog":{"StationID":"FMT","Ft":"20230608130000"}}`,
+		`{"key":"partial`,
+	}, "\n")
+	if err := os.WriteFile(path, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := h.Records()
+	if len(recs) != 1 || recs[0].Key != "FMT_20230605130000_12345" {
+		t.Errorf("Records => %v, want the valid record only", recs)
+	}
+	// the records are safe to read
+	if got := h.Episode(&Prog{StationID: "FMT", Ft: "20230610130000"}); got != 2 {
+		t.Errorf("Episode => %d, want 2", got)
+	}
+}
+
+func TestNilHistory(t *testing.T) {
+	var h *History
+	if h.IsDone(historyProg) {
+		t.Error("nil history should not have the program")
+	}
+	if err := h.Record(historyProg, nil, HistoryStatusCompleted, ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEpisode(t *testing.T) {
+	h, err := LoadHistory(filepath.Join(t.TempDir(), HistoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Episode(historyProg); got != 1 {
+		t.Errorf("Episode => %d, want 1", got)
+	}
+	var nilHistory *History
+	if got := nilHistory.Episode(historyProg); got != 0 {
+		t.Errorf("Episode => %d, want 0", got)
+	}
+}
@@ -0,0 +1,92 @@
+package radicron
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blockElements break the lines in the plain text
+var blockElements = map[atom.Atom]bool{
+	atom.Br:    true,
+	atom.Div:   true,
+	atom.H1:    true,
+	atom.H2:    true,
+	atom.H3:    true,
+	atom.H4:    true,
+	atom.H5:    true,
+	atom.H6:    true,
+	atom.Li:    true,
+	atom.P:     true,
+	atom.Table: true,
+	atom.Tr:    true,
+}
+
+// hiddenElements have the text not to be displayed
+var hiddenElements = map[atom.Atom]bool{
+	atom.Script: true,
+	atom.Style:  true,
+}
+
+// StripHTML returns the plain text and the links in the HTML fragment
+func StripHTML(s string) (string, []string) {
+	z := html.NewTokenizer(strings.NewReader(s))
+	var b strings.Builder
+	links := []string{}
+	seen := map[string]bool{}
+	var hidden atom.Atom // the hidden element until its end tag
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return cleanText(b.String()), links
+		case html.TextToken:
+			if hidden == 0 {
+				b.Write(z.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			tn, hasAttr := z.TagName()
+			a := atom.Lookup(tn)
+			switch {
+			case tt == html.StartTagToken && hiddenElements[a]:
+				hidden = a
+			case tt == html.EndTagToken && a == hidden:
+				hidden = 0
+			}
+			if blockElements[a] {
+				b.WriteString("\n")
+			}
+			for a == atom.A && hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				href := strings.TrimSpace(string(val))
+				if string(key) == "href" && href != "" && !seen[href] {
+					seen[href] = true
+					links = append(links, href)
+				}
+			}
+		default:
+		}
+	}
+}
+
+// cleanText trims the lines and squashes the consecutive blank lines
+func cleanText(s string) string {
+	lines := []string{}
+	blank := false
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,51 @@
+package radicron
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripHTML(t *testing.T) {
+	var htmltests = []struct {
+		in    string
+		text  string
+		links []string
+	}{
+		{
+			"",
+			"",
+			[]string{},
+		},
+		{
+			"plain text",
+			"plain text",
+			[]string{},
+		},
+		{
+			`<div class="station_content_description ">★ゲスト&amp;トーク<br /><br /><br />★番組Webサイト：` +
+				`<a href="https://www.tfm.co.jp/darehana">https://www.tfm.co.jp/darehana</a></div>`,
+			"★ゲスト&トーク\n\n★番組Webサイト：https://www.tfm.co.jp/darehana",
+			[]string{"https://www.tfm.co.jp/darehana"},
+		},
+		{
+			`<a href="https://audee.jp/">AuDee</a> <img src="https://example.com/a.jpg" alt="a"><a href="https://audee.jp/">AuDee</a>`,
+			"AuDee AuDee",
+			[]string{"https://audee.jp/"},
+		},
+		{
+			`A &amp; B<style>p { color: red; }</style><p>line2</p><a href="https://example.com/">link</a>` +
+				`<script>alert(1)</script><script src="https://example.com/a.js"/>`,
+			"A & B\nline2\nlink",
+			[]string{"https://example.com/"},
+		},
+	}
+	for _, tt := range htmltests {
+		text, links := StripHTML(tt.in)
+		if text != tt.text {
+			t.Errorf("StripHTML(%q) => %q, want %q", tt.in, text, tt.text)
+		}
+		if strings.Join(links, ",") != strings.Join(tt.links, ",") {
+			t.Errorf("StripHTML(%q) => %v, want %v", tt.in, links, tt.links)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package radicron
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// maxImageSize is the limit of the image in bytes
+const maxImageSize = 10 * Kilobytes * Kilobytes
+
+// coverImageTypes are the image types embeddable as the cover in all the formats
+var coverImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// CoverImageURL returns the URL of the program image
+// or the station logo if the program has no image
+func CoverImageURL(asset *Asset, prog *Prog) string {
+	if prog.Img != "" {
+		return prog.Img
+	}
+	if asset != nil {
+		if s, ok := asset.Stations[prog.StationID]; ok {
+			return s.Logo
+		}
+	}
+	return ""
+}
+
+// CoverImage returns the path of the cover image for the program in the cache,
+// downloading it unless cached; the path is empty if the program has no image
+func CoverImage(ctx context.Context, asset *Asset, prog *Prog) (string, error) {
+	link := CoverImageURL(asset, prog)
+	if link == "" {
+		return "", nil
+	}
+	dir, err := getRadicronPath(ImageCacheDir)
+	if err != nil {
+		return "", err
+	}
+	return cacheImage(ctx, link, dir)
+}
+
+// cacheImage downloads the image in the dir unless cached and returns the path
+func cacheImage(ctx context.Context, link, dir string) (string, error) {
+	// the name is unique to the URL
+	sum := sha256.Sum256([]byte(link))
+	name := hex.EncodeToString(sum[:])
+	for _, ext := range coverImageTypes {
+		cached := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(cached); err == nil {
+			return cached, nil
+		}
+	}
+
+	blob, err := fetchImage(ctx, link)
+	if err != nil {
+		return "", err
+	}
+	mimeType := http.DetectContentType(blob)
+	ext, ok := coverImageTypes[mimeType]
+	if !ok {
+		return "", fmt.Errorf("%s: unsupported image type %s", link, mimeType)
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd
+		return "", err
+	}
+
+	// write and rename for the other downloads of the same image
+	f, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(blob); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		return "", err
+	}
+	cached := filepath.Join(dir, name+ext)
+	if err = os.Rename(f.Name(), cached); err != nil {
+		return "", err
+	}
+	return cached, nil
+}
+
+// fetchImage returns the image at the link
+func fetchImage(ctx context.Context, link string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", link, resp.Status)
+	}
+	blob, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) > maxImageSize {
+		return nil, fmt.Errorf("%s: the image exceeds %d bytes", link, maxImageSize)
+	}
+	return blob, nil
+}
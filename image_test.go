@@ -0,0 +1,86 @@
+package radicron
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+var pngImage = []byte("\x89PNG\r\n\x1a\nimage")
+
+func TestCoverImage(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/prog.png", "/logo.png":
+			w.Write(pngImage)
+		case "/page.html":
+			w.Write([]byte("<html></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	home := t.TempDir()
+	t.Setenv(EnvRadicronHome, home)
+
+	asset := &Asset{Stations: Stations{"FMT": &Station{Name: "TOKYO FM", Logo: ts.URL + "/logo.png"}}}
+	for _, tt := range []struct {
+		img  string
+		want string
+	}{
+		{ts.URL + "/prog.png", ts.URL + "/prog.png"},
+		{"", ts.URL + "/logo.png"}, // fall back to the station logo
+	} {
+		prog := &Prog{StationID: "FMT", Img: tt.img}
+		if got := CoverImageURL(asset, prog); got != tt.want {
+			t.Errorf("CoverImageURL => %s, want %s", got, tt.want)
+		}
+		cover, err := CoverImage(context.Background(), asset, prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Dir(cover) != filepath.Join(home, ImageCacheDir) || filepath.Ext(cover) != ".png" {
+			t.Errorf("CoverImage => %s, want a png in the cache", cover)
+		}
+		if blob, _ := os.ReadFile(cover); string(blob) != string(pngImage) {
+			t.Errorf("CoverImage => %q, want %q", blob, pngImage)
+		}
+	}
+
+	// cached
+	prog := &Prog{StationID: "FMT", Img: ts.URL + "/prog.png"}
+	if _, err := CoverImage(context.Background(), asset, prog); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("requests => %d, want 2", n)
+	}
+
+	// no image
+	if cover, err := CoverImage(context.Background(), nil, &Prog{StationID: "FMT"}); err != nil || cover != "" {
+		t.Errorf("CoverImage => %s, %v, want none", cover, err)
+	}
+
+	for _, img := range []string{"/missing.png", "/page.html"} {
+		_, err := CoverImage(context.Background(), asset, &Prog{StationID: "FMT", Img: ts.URL + img})
+		if err == nil {
+			t.Errorf("CoverImage should fail with %s", img)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(home, ImageCacheDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("the temporary file %s should be removed", e.Name())
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package radicron
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/yyoshiki41/radigo"
+)
+
+// MetadataDateLayout for the full broadcast timestamp in the tags
+const MetadataDateLayout = "2006-01-02T15:04:05"
+
+// DefaultMetadataTemplates maps the tags to the templates;
+// the keys other than the Metadata fields are written as the custom tags
+var DefaultMetadataTemplates = map[string]string{
+	"title":             "{{.FileBaseName}}",
+	"artist":            "{{.Pfm}}",
+	"album":             "{{.Title}}",
+	"date":              `{{.Date "` + MetadataDateLayout + `"}}`,
+	"genre":             "{{with .Genre.Program}}{{.}}{{else}}{{.Genre.Personality}}{{end}}",
+	"publisher":         "{{.StationName}}",
+	"track":             "{{with .Episode}}{{.}}{{end}}",
+	"comment":           "{{.Info}}",
+	"description":       "{{.Desc}}",
+	"radiko-program-id": "{{.ID}}",
+	"radiko-station-id": "{{.StationID}}",
+}
+
+// MetadataData contains the fields available in the metadata templates,
+// in addition to the ones in the output-template
+type MetadataData struct {
+	OutputData
+	// FileBaseName is the name of the output file without the extension
+	FileBaseName string
+	// Episode is the episode number of the program in the series, 0 if unknown
+	Episode int
+}
+
+// Metadata is the metadata written to the output
+type Metadata struct {
+	Title       string
+	Artist      string
+	Album       string
+	Date        string // MetadataDateLayout
+	Genre       string
+	Publisher   string // the station name
+	Track       string
+	Comment     string
+	Description string
+	Custom      map[string]string
+	Cover       string // optional, the path to the image
+}
+
+// Year returns the year of the Date
+func (md *Metadata) Year() string {
+	if len(md.Date) < len("2006") {
+		return ""
+	}
+	return md.Date[:4]
+}
+
+// CustomKeys returns the keys of the custom tags in order
+func (md *Metadata) CustomKeys() []string {
+	keys := make([]string, 0, len(md.Custom))
+	for k := range md.Custom {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// set sets the value to the tag
+func (md *Metadata) set(key, value string) {
+	if value == "" {
+		return
+	}
+	switch key {
+	case "title":
+		md.Title = value
+	case "artist":
+		md.Artist = value
+	case "album":
+		md.Album = value
+	case "date":
+		md.Date = value
+	case "genre":
+		md.Genre = value
+	case "publisher":
+		md.Publisher = value
+	case "track":
+		md.Track = value
+	case "comment":
+		md.Comment = value
+	case "description":
+		md.Description = value
+	default:
+		if md.Custom == nil {
+			md.Custom = map[string]string{}
+		}
+		md.Custom[key] = value
+	}
+}
+
+// ParseMetadataTemplates parses the metadata templates over the defaults
+// and checks the fields with a sample program; an empty template removes the tag
+func ParseMetadataTemplates(templates map[string]string) (map[string]*template.Template, error) {
+	texts := map[string]string{}
+	for k, v := range DefaultMetadataTemplates {
+		texts[k] = v
+	}
+	for k, v := range templates {
+		texts[strings.ToLower(k)] = v
+	}
+
+	sample := &MetadataData{OutputData: *sampleOutputData(), FileBaseName: "sample", Episode: 1}
+	tmpls := map[string]*template.Template{}
+	for k, text := range texts {
+		if text == "" {
+			continue
+		}
+		tmpl, err := template.New(k).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata template for %s: %s", k, err)
+		}
+		if err = tmpl.Execute(&strings.Builder{}, sample); err != nil {
+			return nil, fmt.Errorf("invalid metadata template for %s: %s", k, err)
+		}
+		tmpls[k] = tmpl
+	}
+	return tmpls, nil
+}
+
+// NewMetadata returns the Metadata for the program matched with the rule and saved in the output
+func NewMetadata(asset *Asset, prog *Prog, rule *Rule, output *radigo.OutputConfig) (*Metadata, error) {
+	var templates map[string]string
+	var history *History
+	if asset != nil {
+		templates = asset.MetadataTemplates
+		history = asset.History
+	}
+	tmpls, err := ParseMetadataTemplates(templates)
+	if err != nil {
+		return nil, err
+	}
+	data, err := newOutputData(asset, prog, rule)
+	if err != nil {
+		return nil, err
+	}
+	md := &Metadata{}
+	mdData := &MetadataData{OutputData: *data, FileBaseName: output.FileBaseName, Episode: history.Episode(prog)}
+	for k, tmpl := range tmpls {
+		var b strings.Builder
+		if err = tmpl.Execute(&b, mdData); err != nil {
+			return nil, fmt.Errorf("error rendering the metadata for %s: %s", k, err)
+		}
+		md.set(k, strings.TrimSpace(b.String()))
+	}
+	return md, nil
+}
@@ -0,0 +1,124 @@
+package radicron
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yyoshiki41/radigo"
+)
+
+var metadataProg = &Prog{
+	ID:        "12345",
+	StationID: "FMT",
+	Ft:        "20230605130000",
+	To:        "20230605145500",
+	Title:     "ある番組/特集",
+	Pfm:       "出演者",
+	Info:      "番組情報",
+	Desc:      "番組説明",
+	Genre:     ProgGenre{Personality: "芸人"},
+}
+
+var metadatatests = []struct {
+	name      string
+	templates map[string]string
+	want      *Metadata
+}{
+	{
+		"default",
+		nil,
+		&Metadata{
+			Title:       "2023-06-05-1300_ある番組／特集",
+			Artist:      "出演者",
+			Album:       "ある番組/特集",
+			Date:        "2023-06-05T13:00:00",
+			Genre:       "芸人",
+			Publisher:   "TOKYO FM",
+			Track:       "2",
+			Comment:     "番組情報",
+			Description: "番組説明",
+			Custom:      map[string]string{"radiko-program-id": "12345", "radiko-station-id": "FMT"},
+		},
+	},
+	{
+		"override",
+		map[string]string{
+			"Title":             `{{.Title}} #{{.Episode}}`,
+			"date":              `{{.Date "2006"}}`,
+			"description":       "",
+			"radiko-program-id": "",
+			"radiko-station-id": "",
+			"rule":              "{{.Rule}}",
+		},
+		&Metadata{
+			Title:     "ある番組/特集 #2",
+			Artist:    "出演者",
+			Album:     "ある番組/特集",
+			Date:      "2023",
+			Genre:     "芸人",
+			Publisher: "TOKYO FM",
+			Track:     "2",
+			Comment:   "番組情報",
+			Custom:    map[string]string{"rule": "rule"},
+		},
+	},
+}
+
+func TestNewMetadata(t *testing.T) {
+	dir := t.TempDir()
+	history, err := LoadHistory(filepath.Join(dir, HistoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the previous episode
+	audio := filepath.Join(dir, "previous.aac")
+	if err = os.WriteFile(audio, []byte("audio"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	previous := *metadataProg
+	previous.Ft = "20230529130000"
+	if err = history.Record(&previous, nil, HistoryStatusCompleted, audio); err != nil {
+		t.Fatal(err)
+	}
+
+	asset := &Asset{
+		History:  history,
+		Stations: Stations{"FMT": &Station{Name: "TOKYO FM"}},
+	}
+	output := &radigo.OutputConfig{FileBaseName: "2023-06-05-1300_ある番組／特集"}
+	for _, tt := range metadatatests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset.MetadataTemplates = tt.templates
+			got, err := NewMetadata(asset, metadataProg, &Rule{Name: "rule"}, output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewMetadata => %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// without the asset
+	got, err := NewMetadata(nil, metadataProg, nil, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Track != "" || got.Publisher != "" || got.Year() != "2023" {
+		t.Errorf("NewMetadata => %+v, want no track and no publisher", got)
+	}
+}
+
+func TestParseMetadataTemplates(t *testing.T) {
+	for _, templates := range []map[string]string{
+		{"title": "{{.Title"},
+		{"title": "{{.Unknown}}"},
+		{"custom": `{{.Date}}`},
+	} {
+		if _, err := ParseMetadataTemplates(templates); err == nil {
+			t.Errorf("ParseMetadataTemplates should fail with %v", templates)
+		}
+	}
+}
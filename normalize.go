@@ -0,0 +1,58 @@
+package radicron
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// the katakana range that has the hiragana counterparts (ァ-ヶ)
+	katakanaFirst = 'ァ'
+	katakanaLast  = 'ヶ'
+	// the katakana iteration marks (ヽ, ヾ)
+	katakanaIterationFirst = 'ヽ'
+	katakanaIterationLast  = 'ヾ'
+	// the offset from katakana to hiragana
+	kanaOffset = 'ァ' - 'ぁ'
+)
+
+var folder = cases.Fold()
+
+// Normalize folds the string for the fuzzy matching of radiko texts
+// 1. NFKC normalization (e.g., "ＴＨＥ" -> "THE", "ｼﾃｨ" -> "シティ")
+// 2. case folding (e.g., "THE" -> "the")
+// 3. kana folding (e.g., "シティ" -> "してぃ")
+// 4. whitespace collapsing (e.g., " the  trad " -> "the trad")
+func Normalize(s string) string {
+	s = norm.NFKC.String(s)
+	s = folder.String(s)
+	s = strings.Map(foldKana, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// foldKana maps a katakana to the hiragana
+func foldKana(r rune) rune {
+	if (katakanaFirst <= r && r <= katakanaLast) ||
+		(katakanaIterationFirst <= r && r <= katakanaIterationLast) {
+		return r - kanaOffset
+	}
+	return r
+}
+
+// containsText returns true if substr is within s, ignoring the differences folded by Normalize unless exact
+func containsText(s, substr string, exact bool) bool {
+	if exact {
+		return strings.Contains(s, substr)
+	}
+	return strings.Contains(Normalize(s), Normalize(substr))
+}
+
+// equalText returns true if s and t are the same, ignoring the differences folded by Normalize unless exact
+func equalText(s, t string, exact bool) bool {
+	if exact {
+		return s == t
+	}
+	return Normalize(s) == Normalize(t)
+}
@@ -0,0 +1,49 @@
+package radicron
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	var normalizetests = []struct {
+		in  string
+		out string
+	}{
+		{"ＴＨＥ　ＴＲＡＤ", "the trad"},
+		{"THE  TRAD ", "the trad"},
+		{"ｼﾃｨﾎﾟｯﾌﾟ", "してぃぽっぷ"},
+		{"シティポップ", "してぃぽっぷ"},
+		{"してぃぽっぷ", "してぃぽっぷ"},
+		{"ヴォーカル", "ゔぉーかる"},
+		{"いすゞ", "いすゞ"},
+		{"Ｊ－ＷＡＶＥ　ＴＯＫＹＯ　ＣＯＭＰＬＥＸ", "j-wave tokyo complex"},
+	}
+	for _, tt := range normalizetests {
+		got := Normalize(tt.in)
+		if got != tt.out {
+			t.Errorf("Normalize(%q) => %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestContainsText(t *testing.T) {
+	var containstests = []struct {
+		s      string
+		substr string
+		exact  bool
+		out    bool
+	}{
+		{"ＴＨＥ ＴＲＡＤ", "THE TRAD", false, true},
+		{"ＴＨＥ ＴＲＡＤ", "THE TRAD", true, false},
+		{"今夜はしてぃぽっぷ特集", "シティポップ", false, true},
+		{"今夜はしてぃぽっぷ特集", "シティポップ", true, false},
+		{"THE TRAD", "the trad", false, true},
+		{"THE TRAD", "the trad", true, false},
+	}
+	for _, tt := range containstests {
+		got := containsText(tt.s, tt.substr, tt.exact)
+		if got != tt.out {
+			t.Errorf("containsText(%q, %q, %v) => %v, want %v", tt.s, tt.substr, tt.exact, got, tt.out)
+		}
+	}
+}
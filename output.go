@@ -0,0 +1,148 @@
+package radicron
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// OutputData contains the fields available in the output-template, e.g.,
+// {{.Rule}}/{{.Title}}/{{.Date "2006-01-02"}}
+type OutputData struct {
+	Prog
+	// Rule is the name of the matched rule
+	Rule string
+	// StationName is the name of the station (e.g., "TOKYO FM")
+	StationName string
+	// StartTime is the start time of the program
+	StartTime time.Time
+}
+
+// Date returns the start time of the program in the layout
+func (d *OutputData) Date(layout string) string {
+	return d.StartTime.Format(layout)
+}
+
+// NewOutputData returns the OutputData for the program matched with the rule
+func NewOutputData(asset *Asset, prog *Prog, rule *Rule) (*OutputData, error) {
+	data, err := newOutputData(asset, prog, rule)
+	if err != nil {
+		return nil, err
+	}
+	// the separators in the values should not create the directories
+	for _, v := range []*string{
+		&data.Title, &data.Pfm, &data.Desc, &data.Info, &data.Rule, &data.StationName,
+	} {
+		*v = escapeSeparator(*v)
+	}
+	return data, nil
+}
+
+// newOutputData returns the OutputData with the values as is
+func newOutputData(asset *Asset, prog *Prog, rule *Rule) (*OutputData, error) {
+	startTime, err := time.ParseInLocation(DatetimeLayout, prog.Ft, Location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time format '%s': %s", prog.Ft, err)
+	}
+	data := &OutputData{
+		Prog:      *prog,
+		Rule:      rule.GetName(),
+		StartTime: startTime,
+	}
+	if asset != nil {
+		if s, ok := asset.Stations[prog.StationID]; ok {
+			data.StationName = s.Name
+		}
+	}
+	return data, nil
+}
+
+// ParseOutputTemplate parses the output-template and checks the fields with a sample program
+func ParseOutputTemplate(text string) (*template.Template, error) {
+	if filepath.IsAbs(text) {
+		return nil, fmt.Errorf("the output-template must be relative to the downloads")
+	}
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = renderOutputTemplate(tmpl, sampleOutputData(), ""); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// sampleOutputData returns the OutputData of a sample program to check the templates
+func sampleOutputData() *OutputData {
+	return &OutputData{
+		Prog: Prog{
+			ID:        "sample",
+			StationID: "FMT",
+			Ft:        "20230605130000",
+			To:        "20230605145500",
+			Title:     "sample",
+		},
+		Rule:        "sample",
+		StationName: "TOKYO FM",
+		StartTime:   time.Date(2023, 6, 5, 13, 0, 0, 0, time.UTC), //nolint:gomnd
+	}
+}
+
+// OutputPath returns the path relative to the downloads without the extension
+// from the output-template of the rule or the global one
+func OutputPath(asset *Asset, prog *Prog, rule *Rule, fileFormat string) (string, error) {
+	text := asset.OutputTemplate
+	if rule != nil && rule.OutputTemplate != "" {
+		text = rule.OutputTemplate
+	}
+	if text == "" {
+		text = DefaultOutputTemplate
+	}
+	tmpl, err := ParseOutputTemplate(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid output-template '%s': %s", text, err)
+	}
+	data, err := NewOutputData(asset, prog, rule)
+	if err != nil {
+		return "", err
+	}
+	outputPath, err := renderOutputTemplate(tmpl, data, fileFormat)
+	if err != nil {
+		return "", err
+	}
+	if rule != nil && rule.Folder != "" {
+		outputPath = filepath.Join(rule.Folder, outputPath)
+	}
+	return outputPath, nil
+}
+
+// renderOutputTemplate executes the template and trims the extension for the fileFormat
+func renderOutputTemplate(tmpl *template.Template, data *OutputData, fileFormat string) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	outputPath := b.String()
+	if fileFormat != "" {
+		outputPath = strings.TrimSuffix(outputPath, "."+fileFormat)
+	}
+	// skip the empty elements from the empty fields
+	elems := []string{}
+	for _, e := range strings.Split(outputPath, "/") {
+		if e = strings.TrimSpace(e); e != "" {
+			elems = append(elems, e)
+		}
+	}
+	outputPath = filepath.Join(elems...)
+	if !filepath.IsLocal(outputPath) {
+		return "", fmt.Errorf("the output path '%s' must be relative to the downloads", outputPath)
+	}
+	return outputPath, nil
+}
+
+// escapeSeparator replaces the path separators with the fullwidth solidus
+func escapeSeparator(s string) string {
+	return strings.NewReplacer("/", "／", "\\", "＼").Replace(s)
+}
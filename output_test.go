@@ -0,0 +1,98 @@
+package radicron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutputPath(t *testing.T) {
+	Location, _ = time.LoadLocation(TZTokyo)
+	asset := &Asset{
+		OutputTemplate: DefaultOutputTemplate,
+		Stations: Stations{
+			"FMT": &Station{Areas: []string{"JP13"}, Name: "TOKYO FM"},
+		},
+	}
+	prog := &Prog{
+		ID:        "9832429167",
+		StationID: "FMT",
+		Ft:        "20230605130000",
+		To:        "20230605145500",
+		Title:     "山崎怜奈の誰かに話したかったこと。",
+		Pfm:       "山崎怜奈",
+	}
+	var outputpathtests = []struct {
+		template string
+		rule     *Rule
+		format   string
+		out      string
+	}{
+		{
+			"",
+			nil,
+			"aac",
+			"202306051300_FMT_山崎怜奈の誰かに話したかったこと。",
+		},
+		{
+			`{{.Rule}}/{{.Title}}/{{.Date "2006-01-02"}}.aac`,
+			&Rule{Name: "darehana"},
+			"aac",
+			"darehana/山崎怜奈の誰かに話したかったこと。/2023-06-05",
+		},
+		{
+			`{{.StationName}}/{{.Pfm}}_{{.Date "20060102"}}.mp3`,
+			&Rule{Name: "darehana", Folder: "talk"},
+			"aac",
+			"talk/TOKYO FM/山崎怜奈_20230605.mp3",
+		},
+		{
+			`{{.StationName}}/{{.Pfm}}`,
+			&Rule{Name: "darehana", OutputTemplate: `{{.Genre.Program}}/{{.ID}}`},
+			"aac",
+			"9832429167",
+		},
+	}
+	for _, tt := range outputpathtests {
+		asset.OutputTemplate = tt.template
+		got, err := OutputPath(asset, prog, tt.rule, tt.format)
+		if err != nil {
+			t.Error(err)
+		}
+		if got != tt.out {
+			t.Errorf("OutputPath(%q, %v) => %q, want %q", tt.template, tt.rule, got, tt.out)
+		}
+	}
+}
+
+func TestOutputPathEscape(t *testing.T) {
+	Location, _ = time.LoadLocation(TZTokyo)
+	prog := &Prog{StationID: "FMT", Ft: "20230605130000", Title: "AC/DC特集"}
+	got, err := OutputPath(&Asset{OutputTemplate: "{{.Title}}/{{.StationID}}"}, prog, nil, "aac")
+	if err != nil {
+		t.Error(err)
+	}
+	want := "AC／DC特集/FMT"
+	if got != want {
+		t.Errorf("OutputPath => %q, want %q", got, want)
+	}
+}
+
+func TestParseOutputTemplate(t *testing.T) {
+	var templatetests = []struct {
+		in  string
+		err bool
+	}{
+		{DefaultOutputTemplate, false},
+		{`{{.Rule}}/{{.Title}}/{{.Date "2006-01-02"}}.aac`, false},
+		{`{{.Title`, true},
+		{`{{.Unknown}}`, true},
+		{`../{{.Title}}`, true},
+		{`/tmp/{{.Title}}`, true},
+	}
+	for _, tt := range templatetests {
+		_, err := ParseOutputTemplate(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseOutputTemplate(%q) => %v, want error: %v", tt.in, err, tt.err)
+		}
+	}
+}
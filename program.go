@@ -1,10 +1,12 @@
 package radicron
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
 // Prog contains the solicited program metadata
@@ -18,13 +20,39 @@ type Prog struct {
 	Info      string
 	Pfm       string
 	Tags      []string
+	Links     []string
 	Genre     ProgGenre
 	M3U8      string
+	Img       string // the URL of the program image
+}
+
+// Duration returns the length of the program
+func (p *Prog) Duration() (time.Duration, error) {
+	ft, err := time.ParseInLocation(DatetimeLayout, p.Ft, Location)
+	if err != nil {
+		return 0, err
+	}
+	to, err := time.ParseInLocation(DatetimeLayout, p.To, Location)
+	if err != nil {
+		return 0, err
+	}
+	return to.Sub(ft), nil
+}
+
+// ExpiryTime returns when the program drops off from the timeshift
+func (p *Prog) ExpiryTime() (time.Time, error) {
+	ft, err := time.ParseInLocation(DatetimeLayout, p.Ft, Location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ft.AddDate(0, 0, TimeshiftRetentionDays), nil
 }
 
 type ProgGenre struct {
-	Personality string
-	Program     string
+	Personality   string
+	PersonalityID string
+	Program       string
+	ProgramID     string
 }
 
 // Progs is a slice of Prog.
@@ -38,20 +66,32 @@ func (ps *Progs) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 
 	stationID := xw.XMLStations.Station[0].StationID
 	for _, p := range xw.XMLStations.Station[0].Progs.Prog {
+		// strip the HTML in desc and info
+		desc, descLinks := StripHTML(p.Desc)
+		info, infoLinks := StripHTML(p.Info)
 		prog := &Prog{
 			ID:        p.ID,
 			StationID: stationID,
 			Ft:        p.Ft,
 			To:        p.To,
 			Title:     p.Title,
-			Desc:      p.Desc,
-			Info:      p.Info,
+			Desc:      desc,
+			Info:      info,
 			Pfm:       p.Pfm,
+			Links:     descLinks,
 			M3U8:      "",
+			Img:       p.Img,
+		}
+		for _, l := range infoLinks {
+			if !contains(prog.Links, l) {
+				prog.Links = append(prog.Links, l)
+			}
 		}
 		prog.Genre = ProgGenre{
-			Personality: p.Genre.Personality.Name,
-			Program:     p.Genre.Program.Name,
+			Personality:   p.Genre.Personality.Name,
+			PersonalityID: p.Genre.Personality.ID,
+			Program:       p.Genre.Program.Name,
+			ProgramID:     p.Genre.Program.ID,
 		}
 		for _, t := range p.Tag.Item {
 			prog.Tags = append(prog.Tags, t.Name)
@@ -71,6 +111,7 @@ type XMLProg struct {
 	Desc  string `xml:"desc"`
 	Info  string `xml:"info"`
 	Pfm   string `xml:"pfm"`
+	Img   string `xml:"img"`
 	Tag   struct {
 		Item []XMLProgItem `xml:"item"`
 	} `xml:"tag"`
@@ -105,10 +146,14 @@ type XMLWeeklyStation struct {
 }
 
 // FetchWeeklyPrograms returns the weekly programs.
-func FetchWeeklyPrograms(stationID string) (Progs, error) {
+func FetchWeeklyPrograms(ctx context.Context, stationID string) (Progs, error) {
 	endpoint := fmt.Sprintf(APIWeeklyProgram, stationID)
 
-	resp, err := http.Get(endpoint) //nolint:gosec,noctx
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return Progs{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return Progs{}, err
 	}
@@ -117,6 +162,34 @@ func FetchWeeklyPrograms(stationID string) (Progs, error) {
 	return decodeWeeklyProgram(resp.Body)
 }
 
+// BroadcastMinutes returns the minutes from 00:00 of the broadcast day for the start time,
+// e.g., 25:30 (i.e., 01:30 in the next day) for "20230626013000"
+func BroadcastMinutes(ft string) (int, error) {
+	st, err := time.ParseInLocation(DatetimeLayout, ft, Location)
+	if err != nil {
+		return 0, err
+	}
+	return toBroadcastMinutes(st.Hour()*60 + st.Minute()), nil
+}
+
+// contains returns true if the slice has the string
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// toBroadcastMinutes shifts the minutes before BroadcastDayStartHour to the previous broadcast day
+func toBroadcastMinutes(m int) int {
+	if m < BroadcastDayStartHour*60 {
+		return m + OneDay*60
+	}
+	return m
+}
+
 func decodeWeeklyProgram(iorc io.ReadCloser) (Progs, error) {
 	progs := Progs{}
 	body, err := io.ReadAll(iorc)
@@ -4,6 +4,7 @@ import (
 	"embed"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -69,9 +70,89 @@ func TestWeeklyProgramUnmarshal(t *testing.T) {
 		t.Errorf("p.Genre.Program => %v, want %v", got, want)
 	}
 
+	got = p.Genre.PersonalityID
+	want = "C010"
+	if got != want {
+		t.Errorf("p.Genre.PersonalityID => %v, want %v", got, want)
+	}
+
+	got = p.Genre.ProgramID
+	want = "P007"
+	if got != want {
+		t.Errorf("p.Genre.ProgramID => %v, want %v", got, want)
+	}
+
+	got = p.Img
+	want = "https://radiko.jp/res/program/DEFAULT_IMAGE/FMT/u2vys0cxtq.jpg"
+	if got != want {
+		t.Errorf("p.Img => %v, want %v", got, want)
+	}
+
+	if strings.ContainsAny(p.Info, "<>") {
+		t.Errorf("p.Info => %v, want no HTML", p.Info)
+	}
+
+	got = strings.SplitN(p.Info, "\n", 2)[0]
+	want = "★ラジオフレンズウィーク！ゲストはMAZZEL からRANさん・SEITOさん！"
+	if got != want {
+		t.Errorf("p.Info => %v, want %v", got, want)
+	}
+
+	if len(p.Links) != 6 || p.Links[0] != "https://audee.jp/program/show/51824" {
+		t.Errorf("p.Links => %v", p.Links)
+	}
+
 	got = strings.Join(p.Tags, ",")
 	want = "山崎怜奈,音楽との出会いが楽しめる,作業がはかどる,気分転換におすすめ,学生におすすめ"
 	if got != want {
 		t.Errorf("p.Tags => %v, want %v", got, want)
 	}
 }
+
+func TestDuration(t *testing.T) {
+	p := &Prog{Ft: "20230605130000", To: "20230605145500"}
+	got, err := p.Duration()
+	if err != nil {
+		t.Error(err)
+	}
+	want := 115 * time.Minute
+	if got != want {
+		t.Errorf("p.Duration() => %v, want %v", got, want)
+	}
+}
+
+func TestExpiryTime(t *testing.T) {
+	p := &Prog{Ft: "20230605130000"}
+	got, err := p.ExpiryTime()
+	if err != nil {
+		t.Error(err)
+	}
+	want := time.Date(2023, 6, 12, 13, 0, 0, 0, Location)
+	if !got.Equal(want) {
+		t.Errorf("p.ExpiryTime() => %v, want %v", got, want)
+	}
+	if _, err = (&Prog{Ft: "invalid"}).ExpiryTime(); err == nil {
+		t.Error("p.ExpiryTime() should fail with an invalid start time")
+	}
+}
+
+func TestBroadcastMinutes(t *testing.T) {
+	var bmtests = []struct {
+		in  string
+		out int
+	}{
+		{"20230605050000", 5 * 60},
+		{"20230605235900", 23*60 + 59},
+		{"20230606000000", 24 * 60},
+		{"20230606045900", 28*60 + 59},
+	}
+	for _, tt := range bmtests {
+		got, err := BroadcastMinutes(tt.in)
+		if err != nil {
+			t.Error(err)
+		}
+		if got != tt.out {
+			t.Errorf("BroadcastMinutes(%v) => %v, want %v", tt.in, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package radicron
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yyoshiki41/radigo"
+)
+
+// Job is a program queued for the download
+type Job struct {
+	Prog   *Prog
+	Rule   *Rule
+	Output *radigo.OutputConfig
+	Expiry time.Time       // when the program drops off from the timeshift
+	ctx    context.Context // the context from Download
+	wg     *sync.WaitGroup // notified when the job is finished
+	seq    int             // the order of the arrival
+}
+
+// Less returns true if the job should run before the other;
+// the program closer to expiring from the timeshift runs first,
+// then the program matched with the higher priority rule
+func (j *Job) Less(other *Job) bool {
+	if !j.Expiry.Equal(other.Expiry) {
+		return j.Expiry.Before(other.Expiry)
+	}
+	if p, q := j.rulePriority(), other.rulePriority(); p != q {
+		return p > q
+	}
+	return j.seq < other.seq
+}
+
+// rulePriority returns the priority of the matched rule
+func (j *Job) rulePriority() int {
+	if j.Rule == nil {
+		return 0
+	}
+	return j.Rule.Priority
+}
+
+// jobHeap is a priority queue of the jobs for container/heap
+type jobHeap []*Job
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(i, j int) bool { return h[i].Less(h[j]) }
+func (h jobHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap) Push(x any)        { *h = append(*h, x.(*Job)) }
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return job
+}
+
+// QueueStats is the state of the Queue
+type QueueStats struct {
+	Queued    int
+	Running   int
+	Completed int
+	Failed    int
+}
+
+func (s QueueStats) String() string {
+	return fmt.Sprintf("queued=%d running=%d completed=%d failed=%d", s.Queued, s.Running, s.Completed, s.Failed)
+}
+
+// Queue runs the jobs by priority with at most MaxParallel programs at once
+type Queue struct {
+	mu          sync.Mutex
+	jobs        jobHeap
+	maxParallel int
+	seq         int
+	stats       QueueStats
+	closed      bool
+	run         func(*Job) string // returns the history status
+}
+
+// NewQueue returns a Queue for the max-parallel-programs
+func NewQueue(maxParallel int) (*Queue, error) {
+	if maxParallel < 1 {
+		return nil, fmt.Errorf("max-parallel-programs must be at least 1")
+	}
+	return &Queue{
+		maxParallel: maxParallel,
+		run: func(job *Job) string {
+			return downloadProgram(job.ctx, job.Prog, job.Rule, job.Output)
+		},
+	}, nil
+}
+
+// Push queues the job and notifies the wg when the job is finished
+func (q *Queue) Push(ctx context.Context, wg *sync.WaitGroup, job *Job) {
+	job.ctx = ctx
+	job.wg = wg
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		interruptJob(job)
+		return
+	}
+	wg.Add(1)
+	if job.Expiry.IsZero() {
+		// the invalid start time has the zero expiry to run first
+		job.Expiry, _ = job.Prog.ExpiryTime()
+	}
+	job.seq = q.seq
+	q.seq++
+	heap.Push(&q.jobs, job)
+	q.stats.Queued++
+	q.dispatch()
+}
+
+// Close stops dispatching the queued jobs and records them as interrupted
+// to resume in the next run; the jobs in progress run until they finish
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	jobs := q.jobs
+	q.jobs = nil
+	q.stats.Queued = 0
+	q.mu.Unlock()
+
+	for _, job := range jobs {
+		interruptJob(job)
+		job.wg.Done()
+	}
+	if len(jobs) > 0 {
+		log.Printf("queue: %d programs interrupted", len(jobs))
+	}
+}
+
+// interruptJob records the job never started as interrupted in the history
+func interruptJob(job *Job) {
+	asset := GetAsset(job.ctx)
+	if asset == nil || job.Output == nil {
+		return
+	}
+	if err := asset.History.Record(job.Prog, job.Rule, HistoryStatusInterrupted, job.Output.AbsPath()); err != nil {
+		log.Printf("failed to record the history: %s", err)
+	}
+}
+
+// Stats returns the current state of the queue
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
+
+// dispatch starts the jobs up to maxParallel; q.mu must be held
+func (q *Queue) dispatch() {
+	for !q.closed && q.stats.Running < q.maxParallel && q.jobs.Len() > 0 {
+		job := heap.Pop(&q.jobs).(*Job)
+		q.stats.Queued--
+		q.stats.Running++
+		go q.work(job)
+	}
+}
+
+// work runs the job and dispatches the next ones
+func (q *Queue) work(job *Job) {
+	defer job.wg.Done()
+	status := q.run(job)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stats.Running--
+	if status == HistoryStatusCompleted {
+		q.stats.Completed++
+	} else {
+		q.stats.Failed++
+	}
+	log.Printf("queue: %s", q.stats)
+	q.dispatch()
+}
@@ -0,0 +1,192 @@
+package radicron
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yyoshiki41/radigo"
+)
+
+var joblesstests = []struct {
+	name string
+	a    *Job
+	b    *Job
+	want bool
+}{
+	{
+		"sooner expiry first",
+		&Job{Prog: &Prog{}, Expiry: time.Date(2023, 6, 8, 13, 0, 0, 0, time.UTC), seq: 1},
+		&Job{Prog: &Prog{}, Expiry: time.Date(2023, 6, 12, 13, 0, 0, 0, time.UTC), Rule: &Rule{Priority: 10}, seq: 0},
+		true,
+	},
+	{
+		"higher priority first",
+		&Job{Prog: &Prog{}, Expiry: time.Date(2023, 6, 12, 13, 0, 0, 0, time.UTC), Rule: &Rule{Priority: 10}, seq: 1},
+		&Job{Prog: &Prog{}, Expiry: time.Date(2023, 6, 12, 13, 0, 0, 0, time.UTC), seq: 0},
+		true,
+	},
+	{
+		"first in first out",
+		&Job{Prog: &Prog{}, Expiry: time.Date(2023, 6, 12, 13, 0, 0, 0, time.UTC), seq: 1},
+		&Job{Prog: &Prog{}, Expiry: time.Date(2023, 6, 12, 13, 0, 0, 0, time.UTC), seq: 0},
+		false,
+	},
+}
+
+func TestJobLess(t *testing.T) {
+	for _, tt := range joblesstests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Less(tt.b); got != tt.want {
+				t.Errorf("Less => %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueue(t *testing.T) {
+	if _, err := NewQueue(0); err == nil {
+		t.Error("NewQueue should fail with max-parallel-programs 0")
+	}
+	q, err := NewQueue(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	order := []string{}
+	release := make(chan struct{})
+	q.run = func(job *Job) string {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		order = append(order, job.Prog.ID)
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if job.Prog.ID == "failed" {
+			return HistoryStatusFailed
+		}
+		return HistoryStatusCompleted
+	}
+
+	wg := sync.WaitGroup{}
+	ctx := context.Background()
+	// the first one runs immediately
+	q.Push(ctx, &wg, &Job{Prog: &Prog{ID: "1", Ft: "20230605130000"}})
+	for started := 0; started < 1; {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		started = len(order)
+		mu.Unlock()
+	}
+	// the rest are ordered by the start time
+	for _, p := range []*Prog{
+		{ID: "5", Ft: "20230605130000"},
+		{ID: "failed", Ft: "20230604130000"},
+		{ID: "3", Ft: "20230601130000"},
+	} {
+		q.Push(ctx, &wg, &Job{Prog: p})
+	}
+	if stats := q.Stats(); stats.Queued != 3 || stats.Running != 1 {
+		t.Errorf("Stats => %s, want queued=3 running=1", stats)
+	}
+
+	close(release)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the queue did not finish")
+	}
+
+	if maxRunning > 1 {
+		t.Errorf("max running => %d, want 1", maxRunning)
+	}
+	want := []string{"1", "3", "failed", "5"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("order => %v, want %v", order, want)
+			break
+		}
+	}
+	if stats := q.Stats(); stats.Completed != 3 || stats.Failed != 1 || stats.Running != 0 || stats.Queued != 0 {
+		t.Errorf("Stats => %s, want completed=3 failed=1", stats)
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	dir := t.TempDir()
+	history, err := LoadHistory(filepath.Join(dir, HistoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), ContextKey("asset"), &Asset{History: history})
+	q, err := NewQueue(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	started := []string{}
+	release := make(chan struct{})
+	q.run = func(job *Job) string {
+		mu.Lock()
+		started = append(started, job.Prog.ID)
+		mu.Unlock()
+		<-release
+		return HistoryStatusCompleted
+	}
+
+	wg := sync.WaitGroup{}
+	output := &radigo.OutputConfig{DirFullPath: dir, FileBaseName: "out", FileFormat: "aac"}
+	for _, p := range []*Prog{
+		{ID: "1", StationID: "FMT", Ft: "20230601130000"},
+		{ID: "2", StationID: "FMT", Ft: "20230602130000"},
+		{ID: "3", StationID: "FMT", Ft: "20230603130000"},
+	} {
+		q.Push(ctx, &wg, &Job{Prog: p, Output: output})
+	}
+	for n := 0; n < 1; {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		n = len(started)
+		mu.Unlock()
+	}
+
+	// the queued jobs are interrupted, and the one in progress finishes
+	q.Close()
+	q.Push(ctx, &wg, &Job{Prog: &Prog{ID: "4", StationID: "FMT", Ft: "20230604130000"}, Output: output})
+	close(release)
+	wg.Wait()
+
+	if len(started) != 1 || started[0] != "1" {
+		t.Errorf("started => %v, want [1]", started)
+	}
+	for _, p := range []*Prog{
+		{ID: "2", StationID: "FMT", Ft: "20230602130000"},
+		{ID: "3", StationID: "FMT", Ft: "20230603130000"},
+		{ID: "4", StationID: "FMT", Ft: "20230604130000"},
+	} {
+		rec, ok := history.Get(p)
+		if !ok || rec.Status != HistoryStatusInterrupted {
+			t.Errorf("history for %s => %+v, want %s", p.ID, rec, HistoryStatusInterrupted)
+		}
+	}
+	if stats := q.Stats(); stats.Queued != 0 || stats.Completed != 1 {
+		t.Errorf("Stats => %s, want queued=0 completed=1", stats)
+	}
+}
@@ -1,6 +1,7 @@
 package radicron
 
 import (
+	"context"
 	"encoding/xml"
 	"io"
 	"net/http"
@@ -17,16 +18,40 @@ type XMLRegionStations struct {
 }
 
 type XMLRegionStation struct {
-	ID     string `xml:"id"`
-	Name   string `xml:"name"`
-	AreaID string `xml:"area_id"`
-	Ruby   string `xml:"ruby"`
+	ID     string                 `xml:"id"`
+	Name   string                 `xml:"name"`
+	AreaID string                 `xml:"area_id"`
+	Ruby   string                 `xml:"ruby"`
+	Logos  []XMLRegionStationLogo `xml:"logo"`
 }
 
-func FetchXMLRegion() (XMLRegion, error) {
+// XMLRegionStationLogo is the station logo in a size
+type XMLRegionStationLogo struct {
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+	URL    string `xml:",chardata"`
+}
+
+// Logo returns the URL of the largest logo
+func (s *XMLRegionStation) Logo() string {
+	logo, area := "", 0
+	for _, l := range s.Logos {
+		if l.Width*l.Height > area {
+			logo, area = l.URL, l.Width*l.Height
+		}
+	}
+	return logo
+}
+
+// FetchXMLRegion returns the full region list
+func FetchXMLRegion(ctx context.Context) (XMLRegion, error) {
 	region := XMLRegion{}
 
-	resp, err := http.Get(APIRegionFull) //nolint:noctx
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, APIRegionFull, http.NoBody)
+	if err != nil {
+		return region, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return region, err
 	}
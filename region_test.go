@@ -1,6 +1,8 @@
 package radicron
 
 import (
+	"context"
+	"encoding/xml"
 	"testing"
 )
 
@@ -8,7 +10,7 @@ func TestFetchXMLRegion(t *testing.T) {
 	const nRegions = 8
 	const nStations = 110
 
-	region, err := FetchXMLRegion()
+	region, err := FetchXMLRegion(context.Background())
 	if err != nil {
 		t.Error("failed to fetch the full region list")
 	}
@@ -26,3 +28,25 @@ func TestFetchXMLRegion(t *testing.T) {
 		t.Errorf("failed to fetch all the stations (%v instead of %v)", stationCount, nStations)
 	}
 }
+
+func TestXMLRegionStationLogo(t *testing.T) {
+	blob := `<station>
+<id>FMT</id>
+<name>TOKYO FM</name>
+<logo width="224" height="100">https://radiko.jp/v2/static/station/logo/FMT/224x100.png</logo>
+<logo width="448" height="200">https://radiko.jp/v2/static/station/logo/FMT/448x200.png</logo>
+<logo width="258" height="60">https://radiko.jp/v2/static/station/logo/FMT/258x60.png</logo>
+<area_id>JP13</area_id>
+</station>`
+	station := XMLRegionStation{}
+	if err := xml.Unmarshal([]byte(blob), &station); err != nil {
+		t.Fatal(err)
+	}
+	want := "https://radiko.jp/v2/static/station/logo/FMT/448x200.png"
+	if got := station.Logo(); got != want {
+		t.Errorf("Logo => %v, want %v", got, want)
+	}
+	if got := (&XMLRegionStation{}).Logo(); got != "" {
+		t.Errorf("Logo => %v, want none", got)
+	}
+}
@@ -0,0 +1,88 @@
+package radicron
+
+import (
+	"strings"
+)
+
+var (
+	// romaji is the Hepburn romanization of hiragana
+	romaji = map[rune]string{
+		'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+		'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+		'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+		'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+		'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+		'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+		'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+		'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+		'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+		'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+		'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+		'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+		'や': "ya", 'ゆ': "yu", 'よ': "yo",
+		'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+		'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+		'ゔ': "vu",
+		'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+		'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+		'・': " ",
+	}
+	// romajiDigraphs are the combinations with the small kana
+	romajiDigraphs = map[string]string{
+		"きゃ": "kya", "きゅ": "kyu", "きょ": "kyo",
+		"ぎゃ": "gya", "ぎゅ": "gyu", "ぎょ": "gyo",
+		"しゃ": "sha", "しゅ": "shu", "しょ": "sho", "しぇ": "she",
+		"じゃ": "ja", "じゅ": "ju", "じょ": "jo", "じぇ": "je",
+		"ちゃ": "cha", "ちゅ": "chu", "ちょ": "cho", "ちぇ": "che",
+		"ぢゃ": "ja", "ぢゅ": "ju", "ぢょ": "jo",
+		"にゃ": "nya", "にゅ": "nyu", "にょ": "nyo",
+		"ひゃ": "hya", "ひゅ": "hyu", "ひょ": "hyo",
+		"びゃ": "bya", "びゅ": "byu", "びょ": "byo",
+		"ぴゃ": "pya", "ぴゅ": "pyu", "ぴょ": "pyo",
+		"みゃ": "mya", "みゅ": "myu", "みょ": "myo",
+		"りゃ": "rya", "りゅ": "ryu", "りょ": "ryo",
+		"てぃ": "ti", "でぃ": "di", "とぅ": "tu", "どぅ": "du",
+		"ふぁ": "fa", "ふぃ": "fi", "ふぇ": "fe", "ふぉ": "fo",
+		"うぃ": "wi", "うぇ": "we", "うぉ": "wo",
+		"ゔぁ": "va", "ゔぃ": "vi", "ゔぇ": "ve", "ゔぉ": "vo",
+	}
+)
+
+// Transliterate converts kana to the Hepburn romanization and leaves the other characters as is
+func Transliterate(s string) string {
+	rs := []rune(strings.Map(foldKana, s))
+	var b strings.Builder
+	sokuon := false // っ doubles the next consonant
+	last := ""
+	for i := 0; i < len(rs); i++ {
+		var roma string
+		if i+1 < len(rs) {
+			roma = romajiDigraphs[string(rs[i:i+2])]
+		}
+		if roma != "" {
+			i++
+		} else if rs[i] == 'っ' {
+			sokuon = true
+			continue
+		} else if rs[i] == 'ー' && last != "" {
+			roma = last[len(last)-1:] // repeat the last vowel
+		} else if r, ok := romaji[rs[i]]; ok {
+			roma = r
+		} else {
+			b.WriteRune(rs[i])
+			last, sokuon = "", false
+			continue
+		}
+		if sokuon {
+			if strings.HasPrefix(roma, "ch") {
+				b.WriteByte('t')
+			} else if roma != "" && !strings.ContainsAny(roma[:1], "aiueon ") {
+				b.WriteByte(roma[0])
+			}
+			sokuon = false
+		}
+		b.WriteString(roma)
+		last = roma
+	}
+	return b.String()
+}
@@ -1,20 +1,39 @@
 package radicron
 
 import (
+	"fmt"
 	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
 
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
 type Rules []*Rule
 
-func (rs Rules) HasMatch(stationID string, p *Prog) bool {
+// Matches returns the matching rules in the descending order of the priority
+func (rs Rules) Matches(stationID string, p *Prog) Rules {
+	matches := Rules{}
 	for _, r := range rs {
 		if r.Match(stationID, p) {
-			return true
+			matches = append(matches, r)
 		}
 	}
-	return false
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Priority > matches[j].Priority
+	})
+	return matches
 }
 
 func (rs Rules) HasRuleWithoutStationID() bool {
@@ -36,20 +55,114 @@ func (rs Rules) HasRuleForStationID(stationID string) bool {
 }
 
 type Rule struct {
-	Name      string   `mapstructure:"name"`       // required
-	Title     string   `mapstructure:"title"`      // required if pfm and keyword are unset
-	DoW       []string `mapstructure:"dow"`        // optional
-	Keyword   string   `mapstructure:"keyword"`    // optional
-	Pfm       string   `mapstructure:"pfm"`        // optional
-	StationID string   `mapstructure:"station-id"` // optional
-	Window    string   `mapstructure:"window"`     // optional
+	Name              string   `mapstructure:"name"`                // required
+	Title             string   `mapstructure:"title"`               // required if pfm and keyword are unset
+	DoW               []string `mapstructure:"dow"`                 // optional
+	ExcludeKeyword    []string `mapstructure:"exclude-keyword"`     // optional
+	ExcludeStationID  []string `mapstructure:"exclude-station"`     // optional
+	ExcludeTitle      []string `mapstructure:"exclude-title"`       // optional
+	Exact             bool     `mapstructure:"exact"`               // optional
+	Expression        string   `mapstructure:"match"`               // optional
+	FileFormat        string   `mapstructure:"file-format"`         // optional
+	Folder            string   `mapstructure:"folder"`              // optional
+	GenrePersonality  string   `mapstructure:"genre-personality"`   // optional
+	GenreProgram      string   `mapstructure:"genre-program"`       // optional
+	Keyword           string   `mapstructure:"keyword"`             // optional
+	KeywordFields     []string `mapstructure:"keyword-fields"`      // optional
+	KeywordRegex      string   `mapstructure:"keyword-regex"`       // optional
+	MaxDuration       string   `mapstructure:"max-duration"`        // optional
+	MinDuration       string   `mapstructure:"min-duration"`        // optional
+	MinimumOutputSize int64    `mapstructure:"minimum-output-size"` // optional (in MB)
+	OutputTemplate    string   `mapstructure:"output-template"`     // optional
+	Pfm               string   `mapstructure:"pfm"`                 // optional
+	PfmRegex          string   `mapstructure:"pfm-regex"`           // optional
+	Priority          int      `mapstructure:"priority"`            // optional
+	StartAfter        string   `mapstructure:"start-after"`         // optional
+	StartBefore       string   `mapstructure:"start-before"`        // optional
+	StationID         string   `mapstructure:"station-id"`          // optional
+	Tag               string   `mapstructure:"tag"`                 // optional
+	TitleRegex        string   `mapstructure:"title-regex"`         // optional
+	Window            string   `mapstructure:"window"`              // optional
+
+	// compiled patterns
+	expr          Expr
+	keywordRegexp *regexp.Regexp
+	pfmRegexp     *regexp.Regexp
+	titleRegexp   *regexp.Regexp
+}
+
+// Compile compiles the regular expressions of the rule
+func (r *Rule) Compile() (err error) {
+	patterns := []struct {
+		key     string
+		pattern string
+		re      **regexp.Regexp
+	}{
+		{"keyword-regex", r.KeywordRegex, &r.keywordRegexp},
+		{"pfm-regex", r.PfmRegex, &r.pfmRegexp},
+		{"title-regex", r.TitleRegex, &r.titleRegexp},
+	}
+	for _, p := range patterns {
+		if p.pattern == "" {
+			*p.re = nil
+			continue
+		}
+		*p.re, err = regexp.Compile(p.pattern)
+		if err != nil {
+			return fmt.Errorf("rule[%s] has an invalid %s '%s': %s", r.Name, p.key, p.pattern, err)
+		}
+	}
+	for key, clock := range map[string]string{"start-after": r.StartAfter, "start-before": r.StartBefore} {
+		if clock == "" {
+			continue
+		}
+		if _, err = parseClock(clock); err != nil {
+			return fmt.Errorf("rule[%s] has an invalid %s '%s': %s", r.Name, key, clock, err)
+		}
+	}
+	for key, d := range map[string]string{"min-duration": r.MinDuration, "max-duration": r.MaxDuration} {
+		if d == "" {
+			continue
+		}
+		if _, err = time.ParseDuration(d); err != nil {
+			return fmt.Errorf("rule[%s] has an invalid %s '%s': %s", r.Name, key, d, err)
+		}
+	}
+	for _, f := range r.KeywordFields {
+		switch strings.ToLower(f) {
+		case "title", "pfm", "info", "desc", "tag", "tags":
+		default:
+			return fmt.Errorf("rule[%s] has an invalid keyword-fields '%s'", r.Name, f)
+		}
+	}
+	if r.FileFormat != "" && !IsValidAudioFormat(r.FileFormat) {
+		return fmt.Errorf("rule[%s] has an unsupported file-format '%s'", r.Name, r.FileFormat)
+	}
+	if r.Folder != "" && (filepath.IsAbs(r.Folder) || !filepath.IsLocal(r.Folder)) {
+		return fmt.Errorf("rule[%s] has an invalid folder '%s' (must be relative to the downloads)", r.Name, r.Folder)
+	}
+	if r.OutputTemplate != "" {
+		if _, err = ParseOutputTemplate(r.OutputTemplate); err != nil {
+			return fmt.Errorf("rule[%s] has an invalid output-template '%s': %s", r.Name, r.OutputTemplate, err)
+		}
+	}
+	r.expr = nil
+	if r.HasExpression() {
+		r.expr, err = ParseExpr(r.Expression, r.Exact)
+		if err != nil {
+			return fmt.Errorf("rule[%s] has an invalid match '%s': %s", r.Name, r.Expression, err)
+		}
+	}
+	return nil
 }
 
 // Match returns true if the rule matches the program
 // 1. check the Window filter
 // 2. check the DoW filter
-// 3. check the StationID
-// 4. match the criteria
+// 3. check the start time and duration filters
+// 4. check the StationID
+// 5. match the criteria
+// 6. check the exclusion criteria
 func (r *Rule) Match(stationID string, p *Prog) bool {
 	// 1. check Window
 	if !r.MatchWindow(p.Ft) {
@@ -59,16 +172,30 @@ func (r *Rule) Match(stationID string, p *Prog) bool {
 	if !r.MatchDoW(p.Ft) {
 		return false
 	}
-	// 3. check station-id
+	// 3. check start-after/start-before and min-duration/max-duration
+	if !r.MatchStartTime(p.Ft) || !r.MatchDuration(p) {
+		return false
+	}
+	// 4. check station-id
 	if !r.MatchStationID(stationID) {
 		return false
 	}
 
-	// 4. match
-	if r.MatchPfm(p.Pfm) && r.MatchTitle(p.Title) && r.MatchKeyword(p) {
-		return true
+	// 5. match
+	if !r.MatchPfm(p.Pfm) || !r.MatchTitle(p.Title) || !r.MatchKeyword(p) ||
+		!r.MatchTag(p.Tags) || !r.MatchGenre(&p.Genre) || !r.MatchExpression(stationID, p) {
+		return false
 	}
-	return false
+	// 6. check exclusion
+	return !r.MatchExclusion(stationID, p)
+}
+
+// GetName returns the name of the rule or NoRuleName if nil
+func (r *Rule) GetName() string {
+	if r == nil {
+		return NoRuleName
+	}
+	return r.Name
 }
 
 func (r *Rule) HasDoW() bool {
@@ -79,10 +206,40 @@ func (r *Rule) HasPfm() bool {
 	return r.Pfm != ""
 }
 
+func (r *Rule) HasPfmRegex() bool {
+	return r.PfmRegex != ""
+}
+
+func (r *Rule) HasExclusion() bool {
+	return len(r.ExcludeKeyword) > 0 ||
+		len(r.ExcludeStationID) > 0 ||
+		len(r.ExcludeTitle) > 0
+}
+
+func (r *Rule) HasExpression() bool {
+	return r.Expression != ""
+}
+
+func (r *Rule) HasDuration() bool {
+	return r.MinDuration != "" || r.MaxDuration != ""
+}
+
+func (r *Rule) HasStartTime() bool {
+	return r.StartAfter != "" || r.StartBefore != ""
+}
+
+func (r *Rule) HasGenre() bool {
+	return r.GenrePersonality != "" || r.GenreProgram != ""
+}
+
 func (r *Rule) HasKeyword() bool {
 	return r.Keyword != ""
 }
 
+func (r *Rule) HasKeywordRegex() bool {
+	return r.KeywordRegex != ""
+}
+
 func (r *Rule) HasStationID() bool {
 	if r.StationID == "" ||
 		r.StationID == "*" {
@@ -91,10 +248,18 @@ func (r *Rule) HasStationID() bool {
 	return true
 }
 
+func (r *Rule) HasTag() bool {
+	return r.Tag != ""
+}
+
 func (r *Rule) HasTitle() bool {
 	return r.Title != ""
 }
 
+func (r *Rule) HasTitleRegex() bool {
+	return r.TitleRegex != ""
+}
+
 func (r *Rule) HasWindow() bool {
 	return r.Window != ""
 }
@@ -103,44 +268,146 @@ func (r *Rule) MatchDoW(ft string) bool {
 	if !r.HasDoW() {
 		return true
 	}
-	dow := map[string]time.Weekday{
-		"sun": time.Sunday,
-		"mon": time.Monday,
-		"tue": time.Tuesday,
-		"wed": time.Wednesday,
-		"thu": time.Thursday,
-		"fri": time.Friday,
-		"sat": time.Saturday,
-	}
 	st, _ := time.ParseInLocation(DatetimeLayout, ft, Location)
 	for _, d := range r.DoW {
-		if st.Weekday() == dow[strings.ToLower(d)] {
+		if st.Weekday() == weekdays[strings.ToLower(d)] {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchDuration returns true if the program length is within min-duration and max-duration
+func (r *Rule) MatchDuration(p *Prog) bool {
+	if !r.HasDuration() {
+		return true
+	}
+	d, err := p.Duration()
+	if err != nil {
+		log.Printf("invalid program time '%s'-'%s': %s", p.Ft, p.To, err)
+		return false
+	}
+	if r.MinDuration != "" {
+		minDuration, err := time.ParseDuration(r.MinDuration)
+		if err != nil {
+			log.Printf("parsing [%s].min-duration failed: %v", r.Name, err)
+			return false
+		}
+		if d < minDuration {
+			return false
+		}
+	}
+	if r.MaxDuration != "" {
+		maxDuration, err := time.ParseDuration(r.MaxDuration)
+		if err != nil {
+			log.Printf("parsing [%s].max-duration failed: %v", r.Name, err)
+			return false
+		}
+		if d > maxDuration {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchExclusion returns true if the program should be excluded from the rule
+func (r *Rule) MatchExclusion(stationID string, p *Prog) bool {
+	if !r.HasExclusion() {
+		return false // if no exclusion, exclude nothing
+	}
+	for _, sid := range r.ExcludeStationID {
+		if sid == stationID {
+			log.Printf("rule[%s] excluded station: '%s'", r.Name, stationID)
 			return true
 		}
 	}
+	for _, t := range r.ExcludeTitle {
+		if containsText(p.Title, t, r.Exact) {
+			log.Printf("rule[%s] excluded title: '%s'", r.Name, p.Title)
+			return true
+		}
+	}
+	for _, k := range r.ExcludeKeyword {
+		for _, s := range []string{p.Title, p.Desc, p.Info} {
+			if containsText(s, k, r.Exact) {
+				log.Printf("rule[%s] excluded with keyword: '%s'", r.Name, k)
+				return true
+			}
+		}
+	}
 	return false
 }
 
+// MatchExpression evaluates the match expression for the program
+func (r *Rule) MatchExpression(stationID string, p *Prog) bool {
+	if !r.HasExpression() {
+		return true // if no expression, match all
+	}
+	if r.expr == nil {
+		e, err := ParseExpr(r.Expression, r.Exact)
+		if err != nil {
+			log.Printf("rule[%s] has an invalid match '%s': %s", r.Name, r.Expression, err)
+			return false
+		}
+		r.expr = e
+	}
+	if r.expr.Eval(stationID, p) {
+		log.Printf("rule[%s] matched with match: '%s'", r.Name, r.Expression)
+		return true
+	}
+	return false
+}
+
+// MatchGenre returns true if the genres match either by the ID (e.g., "P007") or the name (e.g., "トーク")
+func (r *Rule) MatchGenre(g *ProgGenre) bool {
+	if !r.HasGenre() {
+		return true // if no genre, match all
+	}
+	if r.GenrePersonality != "" && !r.matchGenre(r.GenrePersonality, g.PersonalityID, g.Personality) {
+		return false
+	}
+	if r.GenreProgram != "" && !r.matchGenre(r.GenreProgram, g.ProgramID, g.Program) {
+		return false
+	}
+	log.Printf("rule[%s] matched with genre: '%s/%s'", r.Name, g.Personality, g.Program)
+	return true
+}
+
 func (r *Rule) MatchKeyword(p *Prog) bool {
-	if !r.HasKeyword() {
-		return true // if no keyward, match all
+	if r.HasKeyword() && !r.matchKeywordWith(p, func(s string) bool {
+		return containsText(s, r.Keyword, r.Exact)
+	}) {
+		return false
+	}
+	if r.HasKeywordRegex() && !r.matchKeywordWith(p, func(s string) bool {
+		re := r.regexp(&r.keywordRegexp, r.KeywordRegex)
+		return re != nil && re.MatchString(s)
+	}) {
+		return false
 	}
+	return true // if no keyword, match all
+}
 
-	if strings.Contains(p.Title, r.Keyword) {
+// matchKeywordWith returns true if any of the searchable fields satisfies match
+func (r *Rule) matchKeywordWith(p *Prog, match func(string) bool) bool {
+	if r.searchesField("title") && match(p.Title) {
 		log.Printf("rule[%s] matched with title: '%s'", r.Name, p.Title)
 		return true
-	} else if strings.Contains(p.Pfm, r.Keyword) {
+	} else if r.searchesField("pfm") && match(p.Pfm) {
 		log.Printf("rule[%s] matched with pfm: '%s'", r.Name, p.Pfm)
 		return true
-	} else if strings.Contains(p.Info, r.Keyword) {
+	} else if r.searchesField("info") && match(p.Info) {
 		log.Printf("rule[%s] matched with info: %s", r.Name, strings.ReplaceAll(p.Info, "\n", ""))
 		return true
-	} else if strings.Contains(p.Desc, r.Keyword) {
+	} else if r.searchesField("desc") && match(p.Desc) {
 		log.Printf("rule[%s] matched with desc: '%s'", r.Name, strings.ReplaceAll(p.Desc, "\n", ""))
 		return true
 	}
+	if !r.searchesField("tags") {
+		return false
+	}
 	for _, tag := range p.Tags {
-		if strings.Contains(tag, r.Keyword) {
+		if match(tag) {
 			log.Printf("rule[%s] matched with tag: '%s'", r.Name, tag)
 			return true
 		}
@@ -148,15 +415,66 @@ func (r *Rule) MatchKeyword(p *Prog) bool {
 	return false
 }
 
+// searchesField returns true if the keyword should be searched in the field
+func (r *Rule) searchesField(field string) bool {
+	if len(r.KeywordFields) == 0 {
+		return true // if no keyword-fields, search all
+	}
+	for _, f := range r.KeywordFields {
+		f = strings.ToLower(f)
+		if f == field || (f == "tag" && field == "tags") {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Rule) MatchPfm(pfm string) bool {
-	if !r.HasPfm() {
+	if !r.HasPfm() && !r.HasPfmRegex() {
 		return true // if no pfm, match all
 	}
-	if strings.Contains(pfm, r.Pfm) {
-		log.Printf("rule[%s] matched with pfm: '%s'", r.Name, pfm)
+	if r.HasPfm() && !containsText(pfm, r.Pfm, r.Exact) {
+		return false
+	}
+	if r.HasPfmRegex() {
+		re := r.regexp(&r.pfmRegexp, r.PfmRegex)
+		if re == nil || !re.MatchString(pfm) {
+			return false
+		}
+	}
+	log.Printf("rule[%s] matched with pfm: '%s'", r.Name, pfm)
+	return true
+}
+
+// MatchStartTime returns true if the program starts within start-after (inclusive) and start-before (exclusive)
+// in the radiko convention, i.e., 00:00-04:59 is 24:00-28:59 of the previous broadcast day
+func (r *Rule) MatchStartTime(ft string) bool {
+	if !r.HasStartTime() {
 		return true
 	}
-	return false
+	st, err := BroadcastMinutes(ft)
+	if err != nil {
+		log.Printf("invalid start time format '%s': %s", ft, err)
+		return false
+	}
+	after, before := BroadcastDayStartHour*60, (BroadcastDayStartHour+OneDay)*60
+	if r.StartAfter != "" {
+		if after, err = parseClock(r.StartAfter); err != nil {
+			log.Printf("parsing [%s].start-after failed: %v", r.Name, err)
+			return false
+		}
+	}
+	if r.StartBefore != "" {
+		if before, err = parseClock(r.StartBefore); err != nil {
+			log.Printf("parsing [%s].start-before failed: %v", r.Name, err)
+			return false
+		}
+	}
+	after, before = toBroadcastMinutes(after), toBroadcastMinutes(before)
+	if after > before { // e.g., 20:00-05:00
+		return st >= after || st < before
+	}
+	return st >= after && st < before
 }
 
 func (r *Rule) MatchStationID(stationID string) bool {
@@ -169,15 +487,35 @@ func (r *Rule) MatchStationID(stationID string) bool {
 	return false
 }
 
+// MatchTag returns true if any of the tags is exactly the tag
+func (r *Rule) MatchTag(tags []string) bool {
+	if !r.HasTag() {
+		return true // if no tag, match all
+	}
+	for _, tag := range tags {
+		if equalText(tag, r.Tag, r.Exact) {
+			log.Printf("rule[%s] matched with tag: '%s'", r.Name, tag)
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Rule) MatchTitle(title string) bool {
-	if !r.HasTitle() {
+	if !r.HasTitle() && !r.HasTitleRegex() {
 		return true // if not title, match all
 	}
-	if strings.Contains(title, r.Title) {
-		log.Printf("rule[%s] matched with title: '%s'", r.Name, title)
-		return true
+	if r.HasTitle() && !containsText(title, r.Title, r.Exact) {
+		return false
 	}
-	return false
+	if r.HasTitleRegex() {
+		re := r.regexp(&r.titleRegexp, r.TitleRegex)
+		if re == nil || !re.MatchString(title) {
+			return false
+		}
+	}
+	log.Printf("rule[%s] matched with title: '%s'", r.Name, title)
+	return true
 }
 
 func (r *Rule) MatchWindow(ft string) bool {
@@ -201,6 +539,27 @@ func (r *Rule) MatchWindow(ft string) bool {
 	return true
 }
 
+// matchGenre returns true if the genre is either the id or a part of the name
+func (r *Rule) matchGenre(genre, id, name string) bool {
+	if id != "" && strings.EqualFold(genre, id) {
+		return true
+	}
+	return name != "" && containsText(name, genre, r.Exact)
+}
+
+// regexp returns the compiled pattern, compiling it if the rule was not compiled yet
+func (r *Rule) regexp(re **regexp.Regexp, pattern string) *regexp.Regexp {
+	if *re == nil {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("rule[%s] has an invalid pattern '%s': %s", r.Name, pattern, err)
+			return nil
+		}
+		*re = compiled
+	}
+	return *re
+}
+
 func (r *Rule) SetName(name string) {
 	r.Name = name
 }
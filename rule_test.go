@@ -1,6 +1,7 @@
 package radicron
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -12,61 +13,69 @@ var matchtests = []struct {
 	out       bool
 }{
 	{
-		&Rule{"matchtests", "Title", []string{}, "Keyword", "Pfm", "FMT", ""},
+		&Rule{Name: "matchtests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "FMT"},
 		"FMT",
 		&Prog{
-			"ID",
-			"FMT",
-			"20230625050000",
-			"20230625060000",
-			"Title",
-			"Keyword",
-			"",
-			"Pfm",
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "ID",
+			StationID: "FMT",
+			Ft:        "20230625050000",
+			To:        "20230625060000",
+			Title:     "Title",
+			Desc:      "Keyword",
+			Pfm:       "Pfm",
 		},
 		true,
 	},
 	{
-		&Rule{"matchtests", "RadioProgram", []string{}, "Keyword", "Pfm", "FMT", ""},
+		&Rule{Name: "matchtests", Title: "RadioProgram", Keyword: "Keyword", Pfm: "Pfm", StationID: "FMT"},
 		"FMT",
 		&Prog{
-			"ID",
-			"FMT",
-			"20230625050000",
-			"20230625060000",
-			"Title", // title doesn't match
-			"Keyword",
-			"",
-			"Pfm",
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "ID",
+			StationID: "FMT",
+			Ft:        "20230625050000",
+			To:        "20230625060000",
+			Title:     "Title", // title doesn't match
+			Desc:      "Keyword",
+			Pfm:       "Pfm",
 		},
 		false,
 	},
 	{
-		&Rule{"matchtests", "RadioProgram", []string{}, "", "Someone", "FMT", ""},
+		&Rule{Name: "matchtests", Title: "RadioProgram", Pfm: "Someone", StationID: "FMT"},
 		"FMT",
 		&Prog{
-			"ID",
-			"FMT",
-			"20230625050000",
-			"20230625060000",
-			"RadioProgram",
-			"",
-			"",
-			"Pfm", // Pfm doesn't match
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "ID",
+			StationID: "FMT",
+			Ft:        "20230625050000",
+			To:        "20230625060000",
+			Title:     "RadioProgram",
+			Pfm:       "Pfm", // Pfm doesn't match
 		},
 		false,
 	},
 }
 
+func TestMatchExpression(t *testing.T) {
+	r := &Rule{Name: "expressiontests", Keyword: "THE", Expression: "(pfm:稲垣吾郎 or pfm:ハマ・オカモト) and not title:ベスト"}
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	var expressiontests = []struct {
+		p   *Prog
+		out bool
+	}{
+		{&Prog{Title: "THE TRAD", Pfm: "稲垣吾郎"}, true},
+		{&Prog{Title: "THE TRAD ベスト", Pfm: "稲垣吾郎"}, false},
+		{&Prog{Title: "TRAD", Pfm: "稲垣吾郎"}, false},
+	}
+	for _, tt := range expressiontests {
+		got := r.Match("FMT", tt.p)
+		if got != tt.out {
+			t.Errorf("(%v).Match(%v) => %v, want %v", r, tt.p, got, tt.out)
+		}
+	}
+}
+
 func TestMatch(t *testing.T) {
 	for _, tt := range matchtests {
 		got := tt.in.Match(tt.stationID, tt.p)
@@ -82,17 +91,20 @@ var dowtests = []struct {
 	out bool
 }{
 	{
-		&Rule{"dowtests", "Title", []string{}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "dowtests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		"20230625050000", // sun
 		true,
 	},
 	{
-		&Rule{"dowtests", "Title", []string{"sun"}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "dowtests", Title: "Title", DoW: []string{"sun"}, Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		"20230625050000", // sun
 		true,
 	},
 	{
-		&Rule{"dowtests", "Title", []string{"mon", "tue"}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{
+			Name: "dowtests", Title: "Title", DoW: []string{"mon", "tue"},
+			Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window",
+		},
 		"20230625050000", // sun
 		false,
 	},
@@ -107,127 +119,325 @@ func TestMatchDoW(t *testing.T) {
 	}
 }
 
+var exclusiontests = []struct {
+	in        *Rule
+	stationID string
+	prog      *Prog
+	out       bool
+}{
+	{
+		&Rule{Name: "exclusiontests", Keyword: "シティポップ"},
+		"FMT",
+		&Prog{Title: "シティポップ特集", Desc: "Desc", Info: "Info"},
+		true,
+	},
+	{
+		&Rule{Name: "exclusiontests", Keyword: "シティポップ", ExcludeKeyword: []string{"再放送", "ベスト"}},
+		"FMT",
+		&Prog{Title: "シティポップ特集", Desc: "Desc", Info: "【再放送】"},
+		false,
+	},
+	{
+		&Rule{Name: "exclusiontests", Keyword: "シティポップ", ExcludeKeyword: []string{"再放送"}},
+		"FMT",
+		&Prog{Title: "シティポップ特集", Desc: "再放送", Info: "Info"},
+		false,
+	},
+	{
+		&Rule{Name: "exclusiontests", Keyword: "シティポップ", ExcludeTitle: []string{"ベスト"}},
+		"FMT",
+		&Prog{Title: "シティポップ・ベスト", Desc: "Desc", Info: "Info"},
+		false,
+	},
+	{
+		&Rule{Name: "exclusiontests", Keyword: "シティポップ", ExcludeTitle: []string{"ベスト"}},
+		"FMT",
+		&Prog{Title: "シティポップ特集", Desc: "ベスト盤", Info: "Info"},
+		true,
+	},
+	{
+		&Rule{Name: "exclusiontests", Keyword: "シティポップ", ExcludeStationID: []string{"TBS", "LFR"}},
+		"TBS",
+		&Prog{Title: "シティポップ特集", Desc: "Desc", Info: "Info"},
+		false,
+	},
+	{
+		&Rule{Name: "exclusiontests", Keyword: "シティポップ", ExcludeStationID: []string{"TBS", "LFR"}},
+		"FMT",
+		&Prog{Title: "シティポップ特集", Desc: "Desc", Info: "Info"},
+		true,
+	},
+}
+
+func TestMatchExclusion(t *testing.T) {
+	for _, tt := range exclusiontests {
+		got := tt.in.Match(tt.stationID, tt.prog)
+		if got != tt.out {
+			t.Errorf("(%v).Match => %v, want %v", tt.in, got, tt.out)
+		}
+	}
+}
+
+var starttimetests = []struct {
+	in  *Rule
+	ft  string
+	out bool
+}{
+	{
+		&Rule{Name: "starttimetests"},
+		"20230625050000",
+		true,
+	},
+	{
+		&Rule{Name: "starttimetests", StartAfter: "24:00", StartBefore: "29:00"},
+		"20230626013000", // 25:30
+		true,
+	},
+	{
+		&Rule{Name: "starttimetests", StartAfter: "24:00", StartBefore: "29:00"},
+		"20230625233000",
+		false,
+	},
+	{
+		&Rule{Name: "starttimetests", StartAfter: "00:00"}, // same as 24:00
+		"20230625120000",
+		false,
+	},
+	{
+		&Rule{Name: "starttimetests", StartBefore: "09:00"},
+		"20230625050000",
+		true,
+	},
+	{
+		&Rule{Name: "starttimetests", StartBefore: "09:00"},
+		"20230625090000",
+		false,
+	},
+	{
+		&Rule{Name: "starttimetests", StartBefore: "10:00"},
+		"20230626013000", // 25:30 is after 10:00 in the broadcast day
+		false,
+	},
+	{
+		&Rule{Name: "starttimetests", StartAfter: "20:00"},
+		"20230626013000", // 25:30
+		true,
+	},
+	{
+		&Rule{Name: "starttimetests", StartAfter: "22:00", StartBefore: "02:00"},
+		"20230626003000", // 24:30
+		true,
+	},
+	{
+		&Rule{Name: "starttimetests", StartAfter: "22:00", StartBefore: "02:00"},
+		"20230626030000", // 27:00
+		false,
+	},
+}
+
+func TestMatchStartTime(t *testing.T) {
+	for _, tt := range starttimetests {
+		got := tt.in.MatchStartTime(tt.ft)
+		if got != tt.out {
+			t.Errorf("(%v).MatchStartTime(%v) => %v, want %v", tt.in, tt.ft, got, tt.out)
+		}
+	}
+}
+
+var durationtests = []struct {
+	in   *Rule
+	prog *Prog
+	out  bool
+}{
+	{
+		&Rule{Name: "durationtests"},
+		&Prog{Ft: "20230625050000", To: "20230625050500"},
+		true,
+	},
+	{
+		&Rule{Name: "durationtests", MinDuration: "10m"},
+		&Prog{Ft: "20230625050000", To: "20230625050500"},
+		false,
+	},
+	{
+		&Rule{Name: "durationtests", MinDuration: "10m"},
+		&Prog{Ft: "20230625050000", To: "20230625051000"},
+		true,
+	},
+	{
+		&Rule{Name: "durationtests", MinDuration: "10m", MaxDuration: "1h"},
+		&Prog{Ft: "20230625235000", To: "20230626010000"},
+		false,
+	},
+	{
+		&Rule{Name: "durationtests", MaxDuration: "2h"},
+		&Prog{Ft: "20230625235000", To: "20230626010000"},
+		true,
+	},
+}
+
+func TestMatchDuration(t *testing.T) {
+	for _, tt := range durationtests {
+		got := tt.in.MatchDuration(tt.prog)
+		if got != tt.out {
+			t.Errorf("(%v).MatchDuration(%v) => %v, want %v", tt.in, tt.prog, got, tt.out)
+		}
+	}
+}
+
+var genretests = []struct {
+	in    *Rule
+	genre ProgGenre
+	out   bool
+}{
+	{
+		&Rule{Name: "genretests"},
+		ProgGenre{"タレント", "C010", "トーク", "P007"},
+		true,
+	},
+	{
+		&Rule{Name: "genretests", GenreProgram: "トーク"},
+		ProgGenre{"タレント", "C010", "トーク", "P007"},
+		true,
+	},
+	{
+		&Rule{Name: "genretests", GenreProgram: "p007"},
+		ProgGenre{"タレント", "C010", "トーク", "P007"},
+		true,
+	},
+	{
+		&Rule{Name: "genretests", GenreProgram: "音楽"},
+		ProgGenre{"タレント", "C010", "トーク", "P007"},
+		false,
+	},
+	{
+		&Rule{Name: "genretests", GenrePersonality: "C010", GenreProgram: "P007"},
+		ProgGenre{"タレント", "C010", "トーク", "P007"},
+		true,
+	},
+	{
+		&Rule{Name: "genretests", GenrePersonality: "アーティスト", GenreProgram: "P007"},
+		ProgGenre{"タレント", "C010", "トーク", "P007"},
+		false,
+	},
+	{
+		&Rule{Name: "genretests", GenrePersonality: "C010"},
+		ProgGenre{},
+		false,
+	},
+}
+
+func TestMatchGenre(t *testing.T) {
+	for _, tt := range genretests {
+		got := tt.in.MatchGenre(&tt.genre)
+		if got != tt.out {
+			t.Errorf("(%v).MatchGenre(%v) => %v, want %v", tt.in, tt.genre, got, tt.out)
+		}
+	}
+}
+
 var keywordtests = []struct {
 	in   *Rule
 	prog *Prog
 	out  bool
 }{
 	{
-		&Rule{"keywordtests", "Title", []string{}, "", "Pfm", "StationID", "Window"},
+		&Rule{Name: "keywordtests", Title: "Title", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		&Prog{
-			"ID",
-			"StationID",
-			"Ft",
-			"To",
-			"Title",
-			"Desc",
-			"Info",
-			"Pfm",
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "ID",
+			StationID: "StationID",
+			Ft:        "Ft",
+			To:        "To",
+			Title:     "Title",
+			Desc:      "Desc",
+			Info:      "Info",
+			Pfm:       "Pfm",
 		},
 		true,
 	},
 	{
-		&Rule{"keywordtests", "Title", []string{}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "keywordtests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		&Prog{
-			"ID",
-			"StationID",
-			"Ft",
-			"To",
-			"Keyword", // match
-			"Desc",
-			"Info",
-			"Pfm",
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "ID",
+			StationID: "StationID",
+			Ft:        "Ft",
+			To:        "To",
+			Title:     "Keyword", // match
+			Desc:      "Desc",
+			Info:      "Info",
+			Pfm:       "Pfm",
 		},
 		true,
 	},
 	{
-		&Rule{"keywordtests", "Title", []string{}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "keywordtests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		&Prog{
-			"ID",
-			"StationID",
-			"Ft",
-			"To",
-			"Title",
-			"Keyword", // match
-			"Info",
-			"Pfm",
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "ID",
+			StationID: "StationID",
+			Ft:        "Ft",
+			To:        "To",
+			Title:     "Title",
+			Desc:      "Keyword", // match
+			Info:      "Info",
+			Pfm:       "Pfm",
 		},
 		true,
 	},
 	{
-		&Rule{"keywordtests", "Title", []string{}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "keywordtests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		&Prog{
-			"ID",
-			"StationID",
-			"Ft",
-			"To",
-			"Title",
-			"Desc",
-			"Keyword", // match
-			"Pfm",
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "ID",
+			StationID: "StationID",
+			Ft:        "Ft",
+			To:        "To",
+			Title:     "Title",
+			Desc:      "Desc",
+			Info:      "Keyword", // match
+			Pfm:       "Pfm",
 		},
 		true,
 	},
 	{
-		&Rule{"keywordtests", "Title", []string{}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "keywordtests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		&Prog{
-			"test",
-			"test",
-			"test",
-			"test",
-			"test",
-			"test",
-			"test",
-			"Keyword", // match
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "test",
+			StationID: "test",
+			Ft:        "test",
+			To:        "test",
+			Title:     "test",
+			Desc:      "test",
+			Info:      "test",
+			Pfm:       "Keyword", // match
 		},
 		true,
 	},
 	{
-		&Rule{"keywordtests", "Title", []string{}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "keywordtests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		&Prog{
-			"test",
-			"test",
-			"test",
-			"test",
-			"test",
-			"test",
-			"test",
-			"test",
-			[]string{"Keyword"}, // match
-			ProgGenre{},
-			"test",
+			ID:        "test",
+			StationID: "test",
+			Ft:        "test",
+			To:        "test",
+			Title:     "test",
+			Desc:      "test",
+			Info:      "test",
+			Pfm:       "test",
+			Tags:      []string{"Keyword"}, // match
+			M3U8:      "test",
 		},
 		true,
 	},
 	{
-		&Rule{"keywordtests", "Title", []string{}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "keywordtests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		&Prog{
-			"ID",
-			"StationID",
-			"Ft",
-			"To",
-			"Title",
-			"Desc",
-			"Info",
-			"Pfm",
-			[]string{},
-			ProgGenre{},
-			"",
+			ID:        "ID",
+			StationID: "StationID",
+			Ft:        "Ft",
+			To:        "To",
+			Title:     "Title",
+			Desc:      "Desc",
+			Info:      "Info",
+			Pfm:       "Pfm",
 		},
 		false,
 	},
@@ -242,23 +452,90 @@ func TestMatchKeyword(t *testing.T) {
 	}
 }
 
+var keywordfieldstests = []struct {
+	in   *Rule
+	prog *Prog
+	out  bool
+}{
+	{
+		&Rule{Name: "keywordfieldstests", Keyword: "Keyword", KeywordFields: []string{"title", "tags"}},
+		&Prog{Title: "Title", Info: "<a href=\"https://example.com/Keyword\">Info</a>"},
+		false,
+	},
+	{
+		&Rule{Name: "keywordfieldstests", Keyword: "Keyword", KeywordFields: []string{"title", "tags"}},
+		&Prog{Title: "Title", Tags: []string{"Keyword"}},
+		true,
+	},
+	{
+		&Rule{Name: "keywordfieldstests", Keyword: "Keyword", KeywordFields: []string{"Title"}},
+		&Prog{Title: "Keyword"},
+		true,
+	},
+	{
+		&Rule{Name: "keywordfieldstests", KeywordRegex: "^Key", KeywordFields: []string{"desc"}},
+		&Prog{Title: "Keyword", Desc: "Desc"},
+		false,
+	},
+}
+
+func TestMatchKeywordFields(t *testing.T) {
+	for _, tt := range keywordfieldstests {
+		got := tt.in.MatchKeyword(tt.prog)
+		if got != tt.out {
+			t.Errorf("(%v).MatchKeyword => %v, want %v", tt.in, got, tt.out)
+		}
+	}
+}
+
+var tagtests = []struct {
+	in   *Rule
+	tags []string
+	out  bool
+}{
+	{
+		&Rule{Name: "tagtests"},
+		[]string{},
+		true,
+	},
+	{
+		&Rule{Name: "tagtests", Tag: "作業がはかどる"},
+		[]string{"山崎怜奈", "作業がはかどる"},
+		true,
+	},
+	{
+		&Rule{Name: "tagtests", Tag: "作業"},
+		[]string{"山崎怜奈", "作業がはかどる"},
+		false,
+	},
+}
+
+func TestMatchTag(t *testing.T) {
+	for _, tt := range tagtests {
+		got := tt.in.MatchTag(tt.tags)
+		if got != tt.out {
+			t.Errorf("(%v).MatchTag(%v) => %v, want %v", tt.in, tt.tags, got, tt.out)
+		}
+	}
+}
+
 var pfmtests = []struct {
 	in  *Rule
 	pfm string
 	out bool
 }{
 	{
-		&Rule{"pfmtests", "Title", []string{"sun"}, "Keyword", "", "StationID", "Window"},
+		&Rule{Name: "pfmtests", Title: "Title", DoW: []string{"sun"}, Keyword: "Keyword", StationID: "StationID", Window: "Window"},
 		"Pfm",
 		true,
 	},
 	{
-		&Rule{"pfmtests", "", []string{}, "", "Pfm", "", ""},
+		&Rule{Name: "pfmtests", Pfm: "Pfm"},
 		"Pfm",
 		true,
 	},
 	{
-		&Rule{"pfmtests", "", []string{}, "", "Pfm", "", ""},
+		&Rule{Name: "pfmtests", Pfm: "Pfm"},
 		"Someone",
 		false,
 	},
@@ -279,17 +556,17 @@ var stationtests = []struct {
 	out       bool
 }{
 	{
-		&Rule{"stationtests", "Title", []string{"sun"}, "Keyword", "Pfm", "FMT", "Window"},
+		&Rule{Name: "stationtests", Title: "Title", DoW: []string{"sun"}, Keyword: "Keyword", Pfm: "Pfm", StationID: "FMT", Window: "Window"},
 		"FMT",
 		true,
 	},
 	{
-		&Rule{"stationtests", "", []string{}, "", "", "", ""},
+		&Rule{Name: "stationtests"},
 		"FMT",
 		true,
 	},
 	{
-		&Rule{"stationtests", "", []string{}, "", "", "FMT", ""},
+		&Rule{Name: "stationtests", StationID: "FMT"},
 		"TBS",
 		false,
 	},
@@ -310,22 +587,77 @@ var titletests = []struct {
 	out   bool
 }{
 	{
-		&Rule{"titletests", "Title", []string{"sun"}, "Keyword", "Pfm", "FMT", "Window"},
+		&Rule{Name: "titletests", Title: "Title", DoW: []string{"sun"}, Keyword: "Keyword", Pfm: "Pfm", StationID: "FMT", Window: "Window"},
 		"Title",
 		true,
 	},
 	{
-		&Rule{"titletests", "", []string{}, "", "", "", ""},
+		&Rule{Name: "titletests"},
 		"Title",
 		true,
 	},
 	{
-		&Rule{"titletests", "Title", []string{}, "", "", "FMT", ""},
+		&Rule{Name: "titletests", Title: "Title", StationID: "FMT"},
 		"Radio",
 		false,
 	},
 }
 
+func TestMatchNormalized(t *testing.T) {
+	var normalizedtests = []struct {
+		in   *Rule
+		prog *Prog
+		out  bool
+	}{
+		{
+			&Rule{Name: "normalizedtests", Title: "THE TRAD"},
+			&Prog{Title: "ＴＨＥ　ＴＲＡＤ"},
+			true,
+		},
+		{
+			&Rule{Name: "normalizedtests", Title: "THE TRAD", Exact: true},
+			&Prog{Title: "ＴＨＥ　ＴＲＡＤ"},
+			false,
+		},
+		{
+			&Rule{Name: "normalizedtests", Pfm: "ハマ オカモト"},
+			&Prog{Pfm: "ﾊﾏ  ｵｶﾓﾄ"},
+			true,
+		},
+		{
+			&Rule{Name: "normalizedtests", Keyword: "シティポップ"},
+			&Prog{Desc: "今夜は してぃぽっぷ 特集"},
+			true,
+		},
+		{
+			&Rule{Name: "normalizedtests", Keyword: "シティポップ", ExcludeTitle: []string{"best"}},
+			&Prog{Title: "シティポップ BEST"},
+			false,
+		},
+		{
+			&Rule{Name: "normalizedtests", Tag: "ｻｸｷﾞｮｳ"},
+			&Prog{Tags: []string{"サクギョウ"}},
+			true,
+		},
+		{
+			&Rule{Name: "normalizedtests", Expression: "title:'the trad'"},
+			&Prog{Title: "ＴＨＥ　ＴＲＡＤ"},
+			true,
+		},
+		{
+			&Rule{Name: "normalizedtests", Expression: "title:'the trad'", Exact: true},
+			&Prog{Title: "ＴＨＥ　ＴＲＡＤ"},
+			false,
+		},
+	}
+	for _, tt := range normalizedtests {
+		got := tt.in.Match("FMT", tt.prog)
+		if got != tt.out {
+			t.Errorf("(%v).Match(%v) => %v, want %v", tt.in, tt.prog, got, tt.out)
+		}
+	}
+}
+
 func TestMatchTitle(t *testing.T) {
 	for _, tt := range titletests {
 		got := tt.in.MatchTitle(tt.title)
@@ -335,23 +667,103 @@ func TestMatchTitle(t *testing.T) {
 	}
 }
 
+var regextests = []struct {
+	in   *Rule
+	prog *Prog
+	out  bool
+}{
+	{
+		&Rule{Name: "regextests", TitleRegex: "^THE TRAD"},
+		&Prog{Title: "THE TRAD", Pfm: "稲垣吾郎"},
+		true,
+	},
+	{
+		&Rule{Name: "regextests", TitleRegex: "^THE TRAD(?:$|[^再]*$)"},
+		&Prog{Title: "THE TRAD 再放送", Pfm: "稲垣吾郎"},
+		false,
+	},
+	{
+		&Rule{Name: "regextests", PfmRegex: "(稲垣吾郎|ハマ・オカモト)"},
+		&Prog{Title: "THE TRAD", Pfm: "ハマ・オカモト"},
+		true,
+	},
+	{
+		&Rule{Name: "regextests", PfmRegex: "^(稲垣吾郎|ハマ・オカモト)$"},
+		&Prog{Title: "THE TRAD", Pfm: "中田花奈"},
+		false,
+	},
+	{
+		&Rule{Name: "regextests", KeywordRegex: "シティ ?ポップ"},
+		&Prog{Title: "Title", Desc: "今夜はシティポップ特集"},
+		true,
+	},
+	{
+		&Rule{Name: "regextests", Keyword: "特集", KeywordRegex: "^ジャズ"},
+		&Prog{Title: "Title", Desc: "今夜はシティポップ特集"},
+		false,
+	},
+}
+
+func TestMatchRegex(t *testing.T) {
+	for _, tt := range regextests {
+		if err := tt.in.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		got := tt.in.Match("FMT", tt.prog)
+		if got != tt.out {
+			t.Errorf("(%v).Match => %v, want %v", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	var compiletests = []struct {
+		in  *Rule
+		err bool
+	}{
+		{&Rule{Name: "compiletests"}, false},
+		{&Rule{Name: "compiletests", TitleRegex: "^THE TRAD$"}, false},
+		{&Rule{Name: "compiletests", PfmRegex: "(unclosed"}, true},
+		{&Rule{Name: "compiletests", KeywordRegex: "[a-"}, true},
+		{&Rule{Name: "compiletests", Expression: "pfm:A or (station=FMT"}, true},
+		{&Rule{Name: "compiletests", StartAfter: "24:00", StartBefore: "29:00"}, false},
+		{&Rule{Name: "compiletests", StartAfter: "30:00"}, true},
+		{&Rule{Name: "compiletests", MinDuration: "ten minutes"}, true},
+		{&Rule{Name: "compiletests", KeywordFields: []string{"title", "tags"}}, false},
+		{&Rule{Name: "compiletests", KeywordFields: []string{"url"}}, true},
+		{&Rule{Name: "compiletests", FileFormat: "mp3", Folder: "trad/2023"}, false},
+		{&Rule{Name: "compiletests", FileFormat: "wav"}, true},
+		{&Rule{Name: "compiletests", Folder: "../outside"}, true},
+		{&Rule{Name: "compiletests", Folder: "/tmp"}, true},
+	}
+	for _, tt := range compiletests {
+		err := tt.in.Compile()
+		if (err != nil) != tt.err {
+			t.Errorf("(%v).Compile => %v, want error: %v", tt.in, err, tt.err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.in.Name) {
+			t.Errorf("(%v).Compile => %v, want the rule name in the error", tt.in, err)
+		}
+	}
+}
+
 var windowtests = []struct {
 	in  *Rule
 	ft  string
 	out bool
 }{
 	{
-		&Rule{"windowtests", "Title", []string{"sun"}, "Keyword", "Pfm", "FMT", ""},
+		&Rule{Name: "windowtests", Title: "Title", DoW: []string{"sun"}, Keyword: "Keyword", Pfm: "Pfm", StationID: "FMT"},
 		"20230625050000",
 		true,
 	},
 	{
-		&Rule{"windowtests", "", []string{}, "", "", "", "24h"},
+		&Rule{Name: "windowtests", Window: "24h"},
 		time.Now().Add(-1 * time.Hour).Format("20060102150405"),
 		true,
 	},
 	{
-		&Rule{"windowtests", "", []string{}, "", "", "", "24h"},
+		&Rule{Name: "windowtests", Window: "24h"},
 		time.Now().Add(time.Duration(-48) * time.Hour).Format("20060102150405"),
 		false,
 	},
@@ -374,11 +786,11 @@ var ruletests = []struct {
 	out bool
 }{
 	{
-		&Rule{"ruletests", "Title", []string{"sun"}, "Keyword", "Pfm", "StationID", "Window"},
+		&Rule{Name: "ruletests", Title: "Title", DoW: []string{"sun"}, Keyword: "Keyword", Pfm: "Pfm", StationID: "StationID", Window: "Window"},
 		true,
 	},
 	{
-		&Rule{"ruletests", "", []string{}, "", "", "", ""},
+		&Rule{Name: "ruletests"},
 		false,
 	},
 }
@@ -447,16 +859,16 @@ func TestHasRuleFor(t *testing.T) {
 	}{
 		{
 			Rules{
-				&Rule{"rulestests", "Title", []string{}, "Keyword", "Pfm", "FMT", "Window"},
-				&Rule{"rulestests", "Title", []string{}, "Keyword", "Pfm", "TBS", "Window"},
+				&Rule{Name: "rulestests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "FMT", Window: "Window"},
+				&Rule{Name: "rulestests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "TBS", Window: "Window"},
 			},
 			"FMT",
 			true,
 		},
 		{
 			Rules{
-				&Rule{"rulestests", "Title", []string{}, "Keyword", "Pfm", "FMT", "Window"},
-				&Rule{"rulestests", "Title", []string{}, "Keyword", "Pfm", "TBS", "Window"},
+				&Rule{Name: "rulestests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "FMT", Window: "Window"},
+				&Rule{Name: "rulestests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "TBS", Window: "Window"},
 			},
 			"MBS",
 			false,
@@ -477,15 +889,15 @@ func TestHasRuleWithoutStationID(t *testing.T) {
 	}{
 		{
 			Rules{
-				&Rule{"hrwsitests", "Title", []string{}, "Keyword", "Pfm", "", "Window"},
-				&Rule{"hrwsitests", "Title", []string{}, "Keyword", "Pfm", "TBS", "Window"},
+				&Rule{Name: "hrwsitests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", Window: "Window"},
+				&Rule{Name: "hrwsitests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "TBS", Window: "Window"},
 			},
 			true,
 		},
 		{
 			Rules{
-				&Rule{"hrwsitests", "Title", []string{}, "Keyword", "Pfm", "FMT", "Window"},
-				&Rule{"hrwsitests", "Title", []string{}, "Keyword", "Pfm", "TBS", "Window"},
+				&Rule{Name: "hrwsitests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "FMT", Window: "Window"},
+				&Rule{Name: "hrwsitests", Title: "Title", Keyword: "Keyword", Pfm: "Pfm", StationID: "TBS", Window: "Window"},
 			},
 			false,
 		},
@@ -497,3 +909,30 @@ func TestHasRuleWithoutStationID(t *testing.T) {
 		}
 	}
 }
+
+func TestMatches(t *testing.T) {
+	rs := Rules{
+		&Rule{Name: "a", Keyword: "TRAD"},
+		&Rule{Name: "b", Title: "THE TRAD", Priority: 10},
+		&Rule{Name: "c", Pfm: "稲垣吾郎", Priority: 10},
+		&Rule{Name: "d", Pfm: "ハマ・オカモト", Priority: 20},
+	}
+	var matchestests = []struct {
+		p     *Prog
+		names string
+	}{
+		{&Prog{Title: "THE TRAD", Pfm: "稲垣吾郎"}, "b,c,a"},
+		{&Prog{Title: "THE TRAD", Pfm: "ハマ・オカモト"}, "d,b,a"},
+		{&Prog{Title: "TRAD", Pfm: "中田花奈"}, "a"},
+		{&Prog{Title: "Title", Pfm: "Pfm"}, ""},
+	}
+	for _, tt := range matchestests {
+		names := []string{}
+		for _, r := range rs.Matches("FMT", tt.p) {
+			names = append(names, r.Name)
+		}
+		if got := strings.Join(names, ","); got != tt.names {
+			t.Errorf("(%v).Matches(%v) => %v, want %v", rs, tt.p, got, tt.names)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package radicron
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// SanitizeModePOSIX replaces only the characters invalid in POSIX file names
+	SanitizeModePOSIX = "posix"
+	// SanitizeModeWindows also replaces the characters invalid on Windows/SMB shares
+	SanitizeModeWindows = "windows"
+	// SanitizeModeASCII transliterates the file names into ASCII
+	SanitizeModeASCII = "ascii"
+)
+
+var (
+	// windowsReplacer maps the characters invalid on Windows to the fullwidth forms
+	windowsReplacer = strings.NewReplacer(
+		"<", "＜",
+		">", "＞",
+		":", "：",
+		`"`, "＂",
+		"/", "／",
+		`\`, "＼",
+		"|", "｜",
+		"?", "？",
+		"*", "＊",
+	)
+	// windowsReservedNames are the device names reserved on Windows
+	windowsReservedNames = regexp.MustCompile(`(?i)^(CON|PRN|AUX|NUL|COM[1-9]|LPT[1-9])(\..*)?$`)
+	// asciiInvalid matches the characters not safe in ASCII file names
+	asciiInvalid = regexp.MustCompile(`[^A-Za-z0-9 !#$%&'()+,\-.;=@\[\]^_{}~]+`)
+	// asciiUnderscores matches the consecutive replacements
+	asciiUnderscores = regexp.MustCompile(`_+( *_+)*`)
+)
+
+// Sanitizer makes the output paths safe for the file systems
+type Sanitizer struct {
+	// Mode is one of SanitizeModePOSIX, SanitizeModeWindows, or SanitizeModeASCII
+	Mode string
+	// MaxBytes is the maximum length of each path element in bytes
+	MaxBytes int
+}
+
+// NewSanitizer returns a Sanitizer or an error if the mode is invalid
+func NewSanitizer(mode string, maxBytes int) (Sanitizer, error) {
+	switch mode {
+	case SanitizeModePOSIX, SanitizeModeWindows, SanitizeModeASCII:
+	default:
+		return Sanitizer{}, fmt.Errorf("invalid sanitize-mode '%s'", mode)
+	}
+	if maxBytes < MinFilenameBytes {
+		return Sanitizer{}, fmt.Errorf("max-filename-bytes must be at least %d", MinFilenameBytes)
+	}
+	return Sanitizer{Mode: mode, MaxBytes: maxBytes}, nil
+}
+
+// Path sanitizes each element of the path relative to the downloads,
+// and leaves the room for the extension in the base name
+func (s Sanitizer) Path(outputPath, ext string) string {
+	elems := strings.Split(filepath.ToSlash(outputPath), "/")
+	for i, e := range elems {
+		maxBytes := s.MaxBytes
+		if i == len(elems)-1 && ext != "" {
+			maxBytes -= len(ext) + 1 // the dot and the extension
+		}
+		elems[i] = s.Element(e, maxBytes)
+	}
+	return filepath.Join(elems...)
+}
+
+// Element sanitizes a path element and truncates it to maxBytes
+func (s Sanitizer) Element(e string, maxBytes int) string {
+	// the control characters and the separator are invalid everywhere
+	e = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		if r == '/' {
+			return '／'
+		}
+		return r
+	}, e)
+
+	switch s.Mode {
+	case SanitizeModeWindows:
+		e = windowsReplacer.Replace(e)
+	case SanitizeModeASCII:
+		e = norm.NFKC.String(e)
+		e = Transliterate(e)
+		e = asciiInvalid.ReplaceAllString(e, "_")
+		e = asciiUnderscores.ReplaceAllString(e, "_")
+	}
+	e = strings.TrimSpace(e)
+	if s.Mode != SanitizeModePOSIX && windowsReservedNames.MatchString(e) {
+		e = "_" + e
+	}
+	e = truncateBytes(e, maxBytes)
+	if s.Mode != SanitizeModePOSIX {
+		// Windows ignores the trailing dots and spaces
+		e = strings.TrimRight(e, ". ")
+	}
+	switch e {
+	case "", ".", "..":
+		return "_"
+	}
+	return e
+}
+
+// truncateBytes cuts the string to n bytes without breaking the UTF-8 encoding
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return strings.TrimSpace(s[:n])
+}
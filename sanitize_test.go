@@ -0,0 +1,107 @@
+package radicron
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizerElement(t *testing.T) {
+	var sanitizetests = []struct {
+		mode string
+		in   string
+		out  string
+	}{
+		{SanitizeModePOSIX, "THE TRAD", "THE TRAD"},
+		{SanitizeModePOSIX, "AC/DC特集", "AC／DC特集"},
+		{SanitizeModePOSIX, "ラジオ\t深夜便\n", "ラジオ深夜便"},
+		{SanitizeModePOSIX, "..", "_"},
+		{SanitizeModePOSIX, "What's up?: Q&A", "What's up?: Q&A"},
+		{SanitizeModeWindows, "What's up?: Q&A", "What's up？： Q&A"},
+		{SanitizeModeWindows, `<"推し">*|\`, `＜＂推し＂＞＊｜＼`},
+		{SanitizeModeWindows, "CON", "_CON"},
+		{SanitizeModeWindows, "aux.txt", "_aux.txt"},
+		{SanitizeModeWindows, "ラジオ...", "ラジオ"},
+		{SanitizeModeASCII, "ＴＨＥ　ＴＲＡＤ", "THE TRAD"},
+		{SanitizeModeASCII, "シティポップ・レイディオ", "shitipoppu reidio"},
+		{SanitizeModeASCII, "ヒコロヒー", "hikorohii"},
+		{SanitizeModeASCII, "ちゃっかり", "chakkari"},
+		{SanitizeModeASCII, "山崎怜奈の誰かに話したかったこと。", "_no_kani_shitakattakoto_"},
+		{SanitizeModeASCII, "AC/DC: Back in Black?", "AC_DC_ Back in Black_"},
+		{SanitizeModeASCII, "山崎", "_"},
+	}
+	for _, tt := range sanitizetests {
+		s := Sanitizer{Mode: tt.mode, MaxBytes: DefaultMaxFilenameBytes}
+		got := s.Element(tt.in, s.MaxBytes)
+		if got != tt.out {
+			t.Errorf("(%v).Element(%q) => %q, want %q", s, tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestSanitizerPath(t *testing.T) {
+	long := strings.Repeat("オールナイトニッポン", 20) // 600 bytes
+	var pathtests = []struct {
+		mode     string
+		maxBytes int
+		in       string
+		ext      string
+	}{
+		{SanitizeModePOSIX, 255, "rule/" + long, "aac"},
+		{SanitizeModeWindows, 100, long + "/" + long, "mp3"},
+		{SanitizeModeASCII, 64, long + "/" + long, "aac"},
+	}
+	for _, tt := range pathtests {
+		s := Sanitizer{Mode: tt.mode, MaxBytes: tt.maxBytes}
+		got := s.Path(tt.in, tt.ext)
+		elems := strings.Split(got, "/")
+		if len(elems) != 2 {
+			t.Errorf("(%v).Path(%q) => %q, want 2 elements", s, tt.in, got)
+		}
+		for i, e := range elems {
+			n := len(e)
+			if i == len(elems)-1 {
+				n += len(tt.ext) + 1
+			}
+			if n > tt.maxBytes {
+				t.Errorf("(%v).Path(%q) => %q, too long (%d bytes)", s, tt.in, e, n)
+			}
+			if !utf8.ValidString(e) {
+				t.Errorf("(%v).Path(%q) => %q, invalid UTF-8", s, tt.in, e)
+			}
+		}
+	}
+}
+
+func TestTruncateBytes(t *testing.T) {
+	var truncatetests = []struct {
+		in  string
+		n   int
+		out string
+	}{
+		{"radiko", 10, "radiko"},
+		{"radiko", 3, "rad"},
+		{"ラジオ", 9, "ラジオ"},
+		{"ラジオ", 8, "ラジ"},
+		{"ラジオ", 4, "ラ"},
+		{"ラジオ", 2, ""},
+	}
+	for _, tt := range truncatetests {
+		got := truncateBytes(tt.in, tt.n)
+		if got != tt.out {
+			t.Errorf("truncateBytes(%q, %d) => %q, want %q", tt.in, tt.n, got, tt.out)
+		}
+	}
+}
+
+func TestNewSanitizer(t *testing.T) {
+	if _, err := NewSanitizer(SanitizeModeWindows, DefaultMaxFilenameBytes); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewSanitizer("ntfs", DefaultMaxFilenameBytes); err == nil {
+		t.Error("NewSanitizer(\"ntfs\") => nil, want an error")
+	}
+	if _, err := NewSanitizer(SanitizeModePOSIX, 8); err == nil {
+		t.Error("NewSanitizer(8) => nil, want an error")
+	}
+}
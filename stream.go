@@ -0,0 +1,98 @@
+package radicron
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+)
+
+const (
+	// DownloadModeChunks saves the chunks in RADICRON_HOME/tmp to resume the download
+	DownloadModeChunks = "chunks"
+	// DownloadModeStream writes the chunks into the output in order without the temporary files
+	DownloadModeStream = "stream"
+)
+
+// IsValidDownloadMode returns true if the download-mode is supported
+func IsValidDownloadMode(mode string) bool {
+	switch mode {
+	case DownloadModeChunks, DownloadModeStream:
+		return true
+	}
+	return false
+}
+
+// chunkResult is a chunk downloaded in memory
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// streamDownload downloads the chunks concurrently and writes the ADTS frames into the output
+// in the order of the list, keeping at most window chunks in flight or in memory
+func streamDownload(ctx context.Context, list []string, output string, window int) error {
+	if window < 1 {
+		window = DefaultStreamWindow
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	throttle := getThrottle(ctx)
+
+	// each chunk is delivered to its own channel to be written in order
+	results := make([]chan chunkResult, len(list))
+	for i := range results {
+		results[i] = make(chan chunkResult, 1)
+	}
+	// a slot is taken when fetching the chunk and freed when it is written
+	slots := make(chan struct{}, window)
+	go func() {
+		for i, link := range list {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(link string, result chan<- chunkResult) {
+				var buf bytes.Buffer
+				err := retryDownload(ctx, throttle, func() error {
+					buf.Reset()
+					return fetchLink(ctx, link, &buf, throttle.Rate)
+				})
+				result <- chunkResult{data: buf.Bytes(), err: err}
+			}(link, results[i])
+		}
+	}()
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	for i := range list {
+		var result chunkResult
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+			result.err = ctx.Err()
+		}
+		if result.err != nil {
+			err = result.err
+			break
+		}
+		if err = copyADTSFrom(w, list[i], bufio.NewReader(bytes.NewReader(result.data))); err != nil {
+			break
+		}
+		<-slots
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+	}
+	return err
+}
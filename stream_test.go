@@ -0,0 +1,113 @@
+package radicron
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStreamDownload(t *testing.T) {
+	const nChunks = 20
+	const window = 4
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		// the later chunks arrive earlier
+		var i int
+		fmt.Sscanf(r.URL.Path, "/chunk%d.aac", &i)
+		time.Sleep(time.Duration(nChunks-i) * time.Millisecond)
+		w.Header().Set("Content-Type", "audio/aac")
+		w.Write(join(id3Tag("PRIV timestamp"), adtsFrame(strings.Repeat("a", i)), adtsFrame(r.URL.Path)))
+	}))
+	defer ts.Close()
+
+	list := []string{}
+	for i := 0; i < nChunks; i++ {
+		list = append(list, fmt.Sprintf("%s/chunk%d.aac", ts.URL, i))
+	}
+	dir := t.TempDir()
+
+	// the stream download-mode
+	streamed := filepath.Join(dir, "streamed.aac")
+	if err := streamDownload(context.Background(), list, streamed, window); err != nil {
+		t.Fatal(err)
+	}
+	if maxInFlight > window {
+		t.Errorf("max in-flight requests => %d, want at most %d", maxInFlight, window)
+	}
+
+	// the chunks download-mode
+	chunkDir := filepath.Join(dir, "chunks")
+	if err := os.Mkdir(chunkDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := LoadChunkManifest(chunkDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bulkDownload(context.Background(), list, chunkDir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{}
+	for i := 0; i < nChunks; i++ {
+		files = append(files, filepath.Join(chunkDir, fmt.Sprintf("chunk%d.aac", i)))
+	}
+	concated := filepath.Join(dir, "concated.aac")
+	if err = ConcatADTS(context.Background(), files, concated); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(streamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(concated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("the stream download-mode should be byte-identical to the chunks download-mode")
+	}
+}
+
+func TestStreamDownloadError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.aac" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/aac")
+		w.Write(adtsFrame("a"))
+	}))
+	defer ts.Close()
+
+	output := filepath.Join(t.TempDir(), "streamed.aac")
+	list := []string{ts.URL + "/chunk0.aac", ts.URL + "/missing.aac", ts.URL + "/chunk2.aac"}
+	if err := streamDownload(context.Background(), list, output, 2); err == nil {
+		t.Error("streamDownload should fail with a missing chunk")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("the output should be removed on error")
+	}
+}
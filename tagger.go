@@ -0,0 +1,216 @@
+package radicron
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	"github.com/yyoshiki41/radigo"
+)
+
+const (
+	// flacPictureFrontCover is the picture type for the front cover
+	flacPictureFrontCover = 3
+	// id3v24 is the version of ID3v2 with TDRC for the full timestamp
+	id3v24 = 4
+)
+
+// Tagger writes the Metadata to the output file
+type Tagger interface {
+	Tag(ctx context.Context, path string, md *Metadata) error
+}
+
+// NewTagger returns the Tagger native to the file-format:
+// ID3v2 for aac and mp3, MP4 atoms for m4a, and Vorbis comments for opus and flac;
+// m4a has only the iTunes atoms, i.e., neither the publisher nor the custom tags
+func NewTagger(fileFormat string) (Tagger, error) {
+	switch fileFormat {
+	case radigo.AudioFormatAAC, radigo.AudioFormatMP3:
+		return id3Tagger{}, nil
+	case AudioFormatM4A:
+		return &ffmpegTagger{Muxer: "ipod"}, nil
+	case AudioFormatFLAC:
+		return &ffmpegTagger{Muxer: "flac"}, nil
+	case AudioFormatOpus:
+		// the Ogg muxer has no attached picture
+		return &ffmpegTagger{Muxer: "opus", PictureComment: true}, nil
+	}
+	return nil, fmt.Errorf("unsupported audio format: %s", fileFormat)
+}
+
+// id3Tagger writes the ID3v2 tag
+type id3Tagger struct{}
+
+// Tag writes the ID3v2 tag to the file
+func (id3Tagger) Tag(ctx context.Context, path string, md *Metadata) error {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return fmt.Errorf("error while opening the output file: %s", err)
+	}
+	defer tag.Close()
+
+	// Set tags
+	for id, text := range map[string]string{
+		tag.CommonID("Title/Songname/Content description"):                  md.Title,
+		tag.CommonID("Lead artist/Lead performer/Soloist/Performing group"): md.Artist,
+		tag.CommonID("Album/Movie/Show title"):                              md.Album,
+		tag.CommonID("Content type"):                                        md.Genre,
+		tag.CommonID("Publisher"):                                           md.Publisher,
+		tag.CommonID("Internet radio station name"):                         md.Publisher,
+		tag.CommonID("Track number/Position in set"):                        md.Track,
+	} {
+		if text != "" {
+			tag.AddTextFrame(id, id3v2.EncodingUTF8, text)
+		}
+	}
+	if tag.Version() < id3v24 {
+		tag.SetYear(md.Year())
+	} else if md.Date != "" {
+		tag.AddTextFrame(tag.CommonID("Recording time"), id3v2.EncodingUTF8, md.Date)
+	}
+	if md.Comment != "" {
+		tag.AddCommentFrame(id3v2.CommentFrame{
+			Encoding: id3v2.EncodingUTF8,
+			Language: ID3v2LangJPN,
+			Text:     md.Comment,
+		})
+	}
+	if md.Description != "" {
+		tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
+			Encoding: id3v2.EncodingUTF8,
+			Language: ID3v2LangJPN,
+			Lyrics:   md.Description,
+		})
+	}
+	for _, k := range md.CustomKeys() {
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: k,
+			Value:       md.Custom[k],
+		})
+	}
+	if md.Cover != "" {
+		blob, err := os.ReadFile(md.Cover)
+		if err != nil {
+			return err
+		}
+		tag.AddAttachedPicture(id3v2.PictureFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			MimeType:    http.DetectContentType(blob),
+			PictureType: id3v2.PTFrontCover,
+			Picture:     blob,
+		})
+	}
+
+	// write tag to the file
+	if err = tag.Save(); err != nil {
+		return fmt.Errorf("error while saving a tag: %s", err)
+	}
+	return nil
+}
+
+// ffmpegTagger writes the native tags of the container with ffmpeg
+type ffmpegTagger struct {
+	Muxer string
+	// PictureComment embeds the cover in METADATA_BLOCK_PICTURE instead of the attached picture
+	PictureComment bool
+}
+
+// Tag rewrites the file with the tags without encoding the audio
+func (t *ffmpegTagger) Tag(ctx context.Context, path string, md *Metadata) error {
+	metadata, err := t.ffmetadata(md)
+	if err != nil {
+		return err
+	}
+	// the short names since the path may already be at max-filename-bytes
+	dir := filepath.Dir(path)
+	metadataFile, err := writeTemp(dir, ".metadata-*.txt", metadata)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(metadataFile)
+
+	tmp, err := tempName(dir, ".radicron-*"+filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	if err = runFFmpeg(ctx, t.args(path, metadataFile, tmp, md.Cover)...); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// args returns the ffmpeg arguments to copy the streams with the metadata and the cover
+func (t *ffmpegTagger) args(input, metadataFile, output, cover string) []string {
+	args := []string{"-y", "-i", input, "-i", metadataFile}
+	if cover != "" && !t.PictureComment {
+		args = append(args, "-i", cover, "-map", "0:a", "-map", "2:v", "-disposition:v:0", "attached_pic")
+	} else {
+		args = append(args, "-map", "0:a")
+	}
+	return append(args, "-map_metadata", "1", "-map_chapters", "0", "-c", "copy", "-f", t.Muxer, output)
+}
+
+// ffmetadata returns the ffmetadata of the metadata;
+// ffmpeg maps the keys to the MP4 atoms or the Vorbis comments
+func (t *ffmpegTagger) ffmetadata(md *Metadata) (string, error) {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, kv := range [][2]string{
+		{"title", md.Title},
+		{"artist", md.Artist},
+		{"album", md.Album},
+		{"date", md.Date},
+		{"genre", md.Genre},
+		{"publisher", md.Publisher},
+		{"track", md.Track},
+		{"comment", md.Comment},
+		{"description", md.Description},
+	} {
+		if kv[1] != "" {
+			fmt.Fprintf(&b, "%s=%s\n", kv[0], escapeFFMetadata(kv[1]))
+		}
+	}
+	for _, k := range md.CustomKeys() {
+		fmt.Fprintf(&b, "%s=%s\n", escapeFFMetadata(k), escapeFFMetadata(md.Custom[k]))
+	}
+	if md.Cover != "" && t.PictureComment {
+		picture, err := flacPicture(md.Cover)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "METADATA_BLOCK_PICTURE=%s\n", base64.StdEncoding.EncodeToString(picture))
+	}
+	return b.String(), nil
+}
+
+// flacPicture returns the FLAC picture block of the front cover for the Vorbis comment
+func flacPicture(cover string) ([]byte, error) {
+	blob, err := os.ReadFile(cover)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := http.DetectContentType(blob)
+
+	var b bytes.Buffer
+	for _, v := range []any{
+		uint32(flacPictureFrontCover),
+		uint32(len(mimeType)), []byte(mimeType),
+		uint32(0),                                  // no description
+		uint32(0), uint32(0), uint32(0), uint32(0), // width, height, depth, and colors (unknown)
+		uint32(len(blob)), blob,
+	} {
+		if err = binary.Write(&b, binary.BigEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
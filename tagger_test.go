@@ -0,0 +1,334 @@
+package radicron
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bogem/id3v2"
+	"github.com/yyoshiki41/radigo"
+)
+
+var taggertests = []struct {
+	format string
+	cover  string
+	args   string
+}{
+	{
+		"m4a",
+		"",
+		"-y -i in -i meta.txt -map 0:a -map_metadata 1 -map_chapters 0 -c copy -f ipod out",
+	},
+	{
+		"m4a",
+		"cover.jpg",
+		"-y -i in -i meta.txt -i cover.jpg -map 0:a -map 2:v -disposition:v:0 attached_pic -map_metadata 1 -map_chapters 0 -c copy -f ipod out",
+	},
+	{
+		"flac",
+		"cover.jpg",
+		"-y -i in -i meta.txt -i cover.jpg -map 0:a -map 2:v -disposition:v:0 attached_pic -map_metadata 1 -map_chapters 0 -c copy -f flac out",
+	},
+	{
+		"opus",
+		"cover.jpg",
+		"-y -i in -i meta.txt -map 0:a -map_metadata 1 -map_chapters 0 -c copy -f opus out",
+	},
+}
+
+func TestNewTagger(t *testing.T) {
+	for _, tt := range taggertests {
+		t.Run(tt.format, func(t *testing.T) {
+			tagger, err := NewTagger(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ft, ok := tagger.(*ffmpegTagger)
+			if !ok {
+				t.Fatalf("NewTagger => %T, want *ffmpegTagger", tagger)
+			}
+			if got := strings.Join(ft.args("in", "meta.txt", "out", tt.cover), " "); got != tt.args {
+				t.Errorf("args => %s, want %s", got, tt.args)
+			}
+		})
+	}
+
+	for _, format := range []string{radigo.AudioFormatAAC, radigo.AudioFormatMP3} {
+		if tagger, _ := NewTagger(format); tagger != (id3Tagger{}) {
+			t.Errorf("NewTagger(%s) => %T, want id3Tagger", format, tagger)
+		}
+	}
+	if _, err := NewTagger("wav"); err == nil {
+		t.Error("NewTagger should fail with wav")
+	}
+}
+
+func TestFFMetadata(t *testing.T) {
+	dir := t.TempDir()
+	cover := filepath.Join(dir, "cover.png")
+	png := []byte("\x89PNG\r\n\x1a\nimage")
+	if err := os.WriteFile(cover, png, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	md := &Metadata{
+		Title:  "a=b",
+		Artist: "c",
+		Date:   "2023-06-05T13:00:00",
+		Track:  "3",
+		Custom: map[string]string{"radiko-station-id": "FMT"},
+		Cover:  cover,
+	}
+
+	// m4a has the cover as the attached picture
+	got, err := (&ffmpegTagger{Muxer: "ipod"}).ffmetadata(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ";FFMETADATA1\ntitle=a\\=b\nartist=c\ndate=2023-06-05T13:00:00\ntrack=3\nradiko-station-id=FMT\n"
+	if got != want {
+		t.Errorf("ffmetadata => %q, want %q", got, want)
+	}
+
+	// opus has the cover in the Vorbis comment
+	got, err = (&ffmpegTagger{Muxer: "opus", PictureComment: true}).ffmetadata(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := want + "METADATA_BLOCK_PICTURE="
+	if !strings.HasPrefix(got, prefix) {
+		t.Fatalf("ffmetadata => %q, want the prefix %q", got, prefix)
+	}
+	block, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(got, prefix), "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint32(block) != flacPictureFrontCover {
+		t.Errorf("picture type => %d, want %d", binary.BigEndian.Uint32(block), flacPictureFrontCover)
+	}
+	if !bytes.Contains(block, []byte("image/png")) || !bytes.HasSuffix(block, png) {
+		t.Errorf("picture block => %q, want image/png", block)
+	}
+}
+
+func TestID3Tagger(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.aac")
+	if err := os.WriteFile(path, adtsFrame(strings.Repeat("a", 64)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cover := filepath.Join(dir, "cover.png")
+	if err := os.WriteFile(cover, []byte("\x89PNG\r\n\x1a\nimage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	md := &Metadata{
+		Title:       "title",
+		Artist:      "artist",
+		Album:       "album",
+		Date:        "2023-06-05T13:00:00",
+		Genre:       "genre",
+		Publisher:   "TOKYO FM",
+		Track:       "3",
+		Comment:     "info",
+		Description: "desc",
+		Custom:      map[string]string{"radiko-program-id": "12345"},
+		Cover:       cover,
+	}
+	if err := (id3Tagger{}).Tag(context.Background(), path, md); err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	for id, want := range map[string]string{
+		"TIT2": md.Title,
+		"TPE1": md.Artist,
+		"TALB": md.Album,
+		"TDRC": md.Date,
+		"TCON": md.Genre,
+		"TPUB": md.Publisher,
+		"TRSN": md.Publisher,
+		"TRCK": md.Track,
+	} {
+		if got := tag.GetTextFrame(id).Text; got != want {
+			t.Errorf("%s => %s, want %s", id, got, want)
+		}
+	}
+	if comm, ok := tag.GetLastFrame("COMM").(id3v2.CommentFrame); !ok || comm.Text != md.Comment {
+		t.Errorf("COMM => %+v, want %s", tag.GetLastFrame("COMM"), md.Comment)
+	}
+	if uslt, ok := tag.GetLastFrame("USLT").(id3v2.UnsynchronisedLyricsFrame); !ok || uslt.Lyrics != md.Description {
+		t.Errorf("USLT => %+v, want %s", tag.GetLastFrame("USLT"), md.Description)
+	}
+	txxx, ok := tag.GetLastFrame("TXXX").(id3v2.UserDefinedTextFrame)
+	if !ok || txxx.Description != "radiko-program-id" || txxx.Value != "12345" {
+		t.Errorf("TXXX => %+v, want radiko-program-id=12345", tag.GetLastFrame("TXXX"))
+	}
+	if frames := tag.GetFrames("APIC"); len(frames) != 1 {
+		t.Errorf("attached pictures => %d, want 1", len(frames))
+	}
+}
+
+func TestFFmpegTaggerRoundTrip(t *testing.T) {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s is not available", name)
+		}
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// 2 minutes of the source AAC and the cover
+	input := filepath.Join(dir, "in.aac")
+	if err := runFFmpeg(ctx, "-y", "-f", "lavfi", "-i", "sine=frequency=440:duration=120", "-c:a", "aac", "-f", "adts", input); err != nil {
+		t.Fatal(err)
+	}
+	cover := filepath.Join(dir, "cover.png")
+	var b bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 255, A: 255}}, image.Point{}, draw.Src)
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cover, b.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	prog := &Prog{Ft: "20230605130000", To: "20230605130200", Title: "title"}
+	md := &Metadata{
+		Title:     "title",
+		Artist:    "artist",
+		Album:     "album",
+		Date:      "2023-06-05T13:00:00",
+		Genre:     "genre",
+		Publisher: "TOKYO FM",
+		Comment:   "comment",
+		Custom:    map[string]string{"radiko-program-id": "12345", "radiko-station-id": "FMT"},
+		Cover:     cover,
+	}
+	for _, tt := range []struct {
+		format   string
+		chapters int
+		custom   bool // the publisher and the custom tags, which are not in the iTunes atoms
+	}{
+		{AudioFormatM4A, 2, false},
+		{AudioFormatOpus, 0, true},
+		{AudioFormatFLAC, 0, true},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			encoding := Encoding{}
+			if tt.format == AudioFormatM4A {
+				encoding.ChapterInterval = "1m"
+			}
+			encoder, err := NewEncoder(tt.format, encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the name at max-filename-bytes
+			output := filepath.Join(dir, strings.Repeat("a", DefaultMaxFilenameBytes-len(tt.format)-1)+"."+tt.format)
+			if err = encoder.Encode(ctx, input, output, prog); err != nil {
+				t.Fatal(err)
+			}
+			tagger, err := NewTagger(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = tagger.Tag(ctx, output, md); err != nil {
+				t.Fatal(err)
+			}
+
+			probe := ffprobe(t, output)
+			// Ogg has the tags in the stream
+			tags := map[string]string{}
+			for _, m := range append([]map[string]string{probe.Format.Tags}, probe.streamTags()...) {
+				for k, v := range m {
+					tags[strings.ToLower(k)] = v
+				}
+			}
+			want := map[string]string{
+				"title":  md.Title,
+				"artist": md.Artist,
+				"album":  md.Album,
+				"genre":  md.Genre,
+			}
+			if tt.custom {
+				want["publisher"] = md.Publisher
+				for k, v := range md.Custom {
+					want[k] = v
+				}
+			}
+			for k, v := range want {
+				if tags[k] != v {
+					t.Errorf("%s => %q, want %q in %v", k, tags[k], v, tags)
+				}
+			}
+			if !strings.HasPrefix(tags["date"], "2023") {
+				t.Errorf("date => %q, want 2023", tags["date"])
+			}
+			if !probe.hasAttachedPic() {
+				t.Errorf("streams => %+v, want the attached picture", probe.Streams)
+			}
+			if len(probe.Chapters) != tt.chapters {
+				t.Errorf("chapters => %d, want %d", len(probe.Chapters), tt.chapters)
+			}
+		})
+	}
+}
+
+// probeResult is the part of the ffprobe output
+type probeResult struct {
+	Format struct {
+		Tags map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType   string            `json:"codec_type"`
+		Disposition map[string]int    `json:"disposition"`
+		Tags        map[string]string `json:"tags"`
+	} `json:"streams"`
+	Chapters []json.RawMessage `json:"chapters"`
+}
+
+func (p *probeResult) streamTags() []map[string]string {
+	tags := []map[string]string{}
+	for _, s := range p.Streams {
+		tags = append(tags, s.Tags)
+	}
+	return tags
+}
+
+func (p *probeResult) hasAttachedPic() bool {
+	for _, s := range p.Streams {
+		if s.CodecType == "video" && s.Disposition["attached_pic"] == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ffprobe returns the format, the streams, and the chapters of the file
+func ffprobe(t *testing.T, path string) *probeResult {
+	t.Helper()
+	out, err := exec.Command("ffprobe", "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", "-show_chapters", path).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe := &probeResult{}
+	if err = json.Unmarshal(out, probe); err != nil {
+		t.Fatal(err)
+	}
+	return probe
+}
@@ -0,0 +1,292 @@
+package radicron
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxReadBytes is the largest read from a throttled reader to keep the rate smooth
+const maxReadBytes = 32 * Kilobytes
+
+// defaultThrottle is used when the asset has no Throttle
+var defaultThrottle, _ = NewThrottle(MaxConcurrency, 0, nil)
+
+// BandwidthProfile overrides the limits during the time of day, e.g.,
+// unthrottled from 02:00 to 06:00
+type BandwidthProfile struct {
+	Name           string
+	Start          string `mapstructure:"start"`           // HH:MM
+	End            string `mapstructure:"end"`             // HH:MM, can be before the start to wrap around midnight
+	BandwidthLimit int64  `mapstructure:"bandwidth-limit"` // optional (in KB/s), 0 for unlimited
+	MaxConcurrency int    `mapstructure:"max-concurrency"` // optional, 0 for the global max-concurrency
+	start          int
+	end            int
+}
+
+// BandwidthProfiles is the named profiles from the config
+type BandwidthProfiles map[string]*BandwidthProfile
+
+// Compile validates the profile
+func (bp *BandwidthProfile) Compile() (err error) {
+	if bp.start, err = parseDayClock(bp.Start); err != nil {
+		return fmt.Errorf("bandwidth-profile[%s] has an invalid start '%s': %s", bp.Name, bp.Start, err)
+	}
+	if bp.end, err = parseDayClock(bp.End); err != nil {
+		return fmt.Errorf("bandwidth-profile[%s] has an invalid end '%s': %s", bp.Name, bp.End, err)
+	}
+	if bp.BandwidthLimit < 0 {
+		return fmt.Errorf("bandwidth-profile[%s] has an invalid bandwidth-limit '%d'", bp.Name, bp.BandwidthLimit)
+	}
+	if bp.MaxConcurrency < 0 {
+		return fmt.Errorf("bandwidth-profile[%s] has an invalid max-concurrency '%d'", bp.Name, bp.MaxConcurrency)
+	}
+	return nil
+}
+
+// IsActive returns true if the time of day is within the profile
+func (bp *BandwidthProfile) IsActive(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if bp.start <= bp.end {
+		return bp.start <= m && m < bp.end
+	}
+	// e.g., 22:00-02:00
+	return bp.start <= m || m < bp.end
+}
+
+// parseDayClock returns the minutes of HH:MM within a day
+func parseDayClock(s string) (int, error) {
+	m, err := parseClock(s)
+	if err != nil {
+		return 0, err
+	}
+	if m > OneDay*60 {
+		return 0, fmt.Errorf("invalid time '%s' (want 00:00-24:00)", s)
+	}
+	return m, nil
+}
+
+// Throttle limits the concurrency and the bandwidth shared by all the chunk downloads
+type Throttle struct {
+	Concurrency *ConcurrencyLimiter
+	Rate        *RateLimiter
+
+	mu             sync.Mutex
+	active         *BandwidthProfile
+	bandwidthLimit int64 // in KB/s
+	maxConcurrency int
+	profiles       []*BandwidthProfile
+}
+
+// NewThrottle returns a Throttle with the global limits and the profiles
+func NewThrottle(maxConcurrency int, bandwidthLimit int64, profiles BandwidthProfiles) (*Throttle, error) {
+	if maxConcurrency < 1 {
+		return nil, fmt.Errorf("max-concurrency must be at least 1")
+	}
+	if bandwidthLimit < 0 {
+		return nil, fmt.Errorf("bandwidth-limit must not be negative")
+	}
+	t := &Throttle{
+		Concurrency:    NewConcurrencyLimiter(maxConcurrency),
+		Rate:           NewRateLimiter(bandwidthLimit * Kilobytes),
+		bandwidthLimit: bandwidthLimit,
+		maxConcurrency: maxConcurrency,
+	}
+	for name, bp := range profiles {
+		bp.Name = name
+		if err := bp.Compile(); err != nil {
+			return nil, err
+		}
+		t.profiles = append(t.profiles, bp)
+	}
+	// the first profile by name wins if they overlap
+	sort.Slice(t.profiles, func(i, j int) bool {
+		return t.profiles[i].Name < t.profiles[j].Name
+	})
+	return t, nil
+}
+
+// Acquire waits for a slot after applying the profile for the current time
+func (t *Throttle) Acquire(ctx context.Context) error {
+	t.Update(time.Now().In(Location))
+	return t.Concurrency.Acquire(ctx)
+}
+
+// Release frees the slot
+func (t *Throttle) Release() {
+	t.Concurrency.Release()
+}
+
+// Update applies the limits of the profile active at the time
+func (t *Throttle) Update(now time.Time) {
+	var active *BandwidthProfile
+	for _, bp := range t.profiles {
+		if bp.IsActive(now) {
+			active = bp
+			break
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if active == t.active {
+		return
+	}
+	t.active = active
+
+	maxConcurrency, bandwidthLimit := t.maxConcurrency, t.bandwidthLimit
+	if active != nil {
+		bandwidthLimit = active.BandwidthLimit
+		if active.MaxConcurrency > 0 {
+			maxConcurrency = active.MaxConcurrency
+		}
+		log.Printf("bandwidth-profile[%s] is active: max-concurrency=%d, bandwidth-limit=%d KB/s",
+			active.Name, maxConcurrency, bandwidthLimit)
+	} else {
+		log.Printf("bandwidth-profile is inactive: max-concurrency=%d, bandwidth-limit=%d KB/s",
+			maxConcurrency, bandwidthLimit)
+	}
+	t.Concurrency.SetLimit(maxConcurrency)
+	t.Rate.SetRate(bandwidthLimit * Kilobytes)
+}
+
+// ConcurrencyLimiter is a semaphore with the limit adjustable at runtime
+type ConcurrencyLimiter struct {
+	mu    sync.Mutex
+	count int
+	limit int
+	ready chan struct{} // closed when a slot may be available
+}
+
+// NewConcurrencyLimiter returns a ConcurrencyLimiter for the limit
+func NewConcurrencyLimiter(limit int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		limit: limit,
+		ready: make(chan struct{}),
+	}
+}
+
+// Acquire waits for a slot until the ctx is done
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.count < l.limit {
+			l.count++
+			l.mu.Unlock()
+			return nil
+		}
+		ready := l.ready
+		l.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release frees a slot
+func (l *ConcurrencyLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count--
+	l.notify()
+}
+
+// SetLimit changes the limit; the slots in use beyond the limit are kept until released
+func (l *ConcurrencyLimiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.notify()
+}
+
+// notify wakes up the waiting goroutines
+func (l *ConcurrencyLimiter) notify() {
+	close(l.ready)
+	l.ready = make(chan struct{})
+}
+
+// RateLimiter is a token bucket for the bytes per second with the burst of one second
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second, 0 for unlimited
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter for the rate in bytes per second
+func NewRateLimiter(rate int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate changes the rate in bytes per second, 0 for unlimited
+func (l *RateLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(rate)
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// WaitN takes n bytes from the bucket and waits until they are available
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	// reserve the tokens in advance so that the waiting readers are in order
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	return sleepContext(ctx, wait)
+}
+
+// Reader returns the reader throttled by the limiter
+func (l *RateLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &rateLimitedReader{ctx: ctx, r: r, limiter: l}
+}
+
+// rateLimitedReader waits for the limiter after each read
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxReadBytes {
+		p = p[:maxReadBytes]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,160 @@
+package radicron
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+var bandwidthprofiletests = []struct {
+	name   string
+	start  string
+	end    string
+	now    string
+	active bool
+}{
+	{"within", "02:00", "06:00", "03:30", true},
+	{"at the start", "02:00", "06:00", "02:00", true},
+	{"at the end", "02:00", "06:00", "06:00", false},
+	{"before", "02:00", "06:00", "01:59", false},
+	{"wrap before midnight", "22:00", "02:00", "23:00", true},
+	{"wrap after midnight", "22:00", "02:00", "01:00", true},
+	{"wrap outside", "22:00", "02:00", "12:00", false},
+	{"all day", "00:00", "24:00", "23:59", true},
+}
+
+func TestBandwidthProfileIsActive(t *testing.T) {
+	for _, tt := range bandwidthprofiletests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp := &BandwidthProfile{Name: tt.name, Start: tt.start, End: tt.end}
+			if err := bp.Compile(); err != nil {
+				t.Fatal(err)
+			}
+			now, err := time.Parse("15:04", tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bp.IsActive(now); got != tt.active {
+				t.Errorf("IsActive(%s) => %v, want %v", tt.now, got, tt.active)
+			}
+		})
+	}
+}
+
+func TestNewThrottle(t *testing.T) {
+	for _, bp := range []*BandwidthProfile{
+		{Start: "25:00", End: "06:00"},
+		{Start: "02:00", End: "6am"},
+		{Start: "02:00", End: "06:00", BandwidthLimit: -1},
+		{Start: "02:00", End: "06:00", MaxConcurrency: -1},
+	} {
+		if _, err := NewThrottle(MaxConcurrency, 0, BandwidthProfiles{"invalid": bp}); err == nil {
+			t.Errorf("NewThrottle should fail with %+v", bp)
+		}
+	}
+	if _, err := NewThrottle(0, 0, nil); err == nil {
+		t.Error("NewThrottle should fail with max-concurrency 0")
+	}
+	if _, err := NewThrottle(1, -1, nil); err == nil {
+		t.Error("NewThrottle should fail with a negative bandwidth-limit")
+	}
+}
+
+func TestThrottleUpdate(t *testing.T) {
+	throttle, err := NewThrottle(4, 512, BandwidthProfiles{
+		"night": {Start: "02:00", End: "06:00", MaxConcurrency: 16},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	night := time.Date(2023, 6, 5, 3, 0, 0, 0, time.UTC)
+	day := time.Date(2023, 6, 5, 12, 0, 0, 0, time.UTC)
+
+	throttle.Update(night)
+	if throttle.Concurrency.limit != 16 || throttle.Rate.rate != 0 {
+		t.Errorf("night => %d, %v, want 16, unlimited", throttle.Concurrency.limit, throttle.Rate.rate)
+	}
+	throttle.Update(day)
+	if throttle.Concurrency.limit != 4 || throttle.Rate.rate != 512*Kilobytes {
+		t.Errorf("day => %d, %v, want 4, %d", throttle.Concurrency.limit, throttle.Rate.rate, 512*Kilobytes)
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := NewConcurrencyLimiter(1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the limit is reached
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire => %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// raising the limit wakes up the waiting one
+	done := make(chan error)
+	go func() {
+		done <- l.Acquire(context.Background())
+	}()
+	l.SetLimit(2)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Acquire should succeed after SetLimit")
+	}
+
+	// releasing a slot wakes up the waiting one
+	go func() {
+		done <- l.Acquire(context.Background())
+	}()
+	l.Release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Acquire should succeed after Release")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	blob := bytes.Repeat([]byte("a"), 20*Kilobytes)
+
+	// 20 KB at 100 KB/s takes 200 ms
+	l := NewRateLimiter(100 * Kilobytes)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, l.Reader(context.Background(), bytes.NewReader(blob)))
+	if err != nil || n != int64(len(blob)) {
+		t.Fatalf("io.Copy => %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("throttled copy took %v, want at least 150ms", elapsed)
+	}
+
+	// unlimited
+	l.SetRate(0)
+	start = time.Now()
+	if _, err = io.Copy(io.Discard, l.Reader(context.Background(), bytes.NewReader(blob))); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("unlimited copy took %v", elapsed)
+	}
+
+	// cancel while waiting
+	l.SetRate(Kilobytes)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = io.Copy(io.Discard, l.Reader(ctx, bytes.NewReader(blob))); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("io.Copy => %v, want %v", err, context.DeadlineExceeded)
+	}
+}